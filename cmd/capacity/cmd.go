@@ -0,0 +1,166 @@
+package capacity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bshore/steggo/pkg/embedder"
+	"github.com/bshore/steggo/pkg/encoders"
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "capacity",
+	Short: "Reports how many bytes --target {file} can hold in each embed mode",
+	RunE:  capacityCmdFn,
+}
+
+var (
+	targetFile  string
+	preEncoding []string
+	jsonOutput  bool
+)
+
+func InitCmd() {
+	Cmd.PersistentFlags().StringVarP(&targetFile, "target", "t", "", "The path to the file to report the capacity of, - for stdin")
+	Cmd.PersistentFlags().StringArrayVarP(&preEncoding, "pre-encoding", "p", []string{}, "(Optional) The pre-encoders the message will be embedded with, to report how large a message still fits")
+	Cmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "(Optional) Print the report as JSON")
+}
+
+// modeReport is the capacity of one mode along with the largest message that fits once pre-encoded
+type modeReport struct {
+	embedder.ModeCapacity
+	Message int `json:"message"`
+}
+
+// encoderReport is the largest message that fits in the default mode with a single pre-encoder
+type encoderReport struct {
+	Name    string `json:"name"`
+	Message int    `json:"message"`
+}
+
+type report struct {
+	Target      string          `json:"target"`
+	Format      string          `json:"format"`
+	PreEncoding []string        `json:"pre_encoding"`
+	Modes       []modeReport    `json:"modes"`
+	Encoders    []encoderReport `json:"encoders,omitempty"`
+}
+
+func capacityCmdFn(command *cobra.Command, args []string) (err error) {
+	if targetFile == "" {
+		return fmt.Errorf("--target is required")
+	}
+	names := encoders.SplitNames(preEncoding)
+	preEncoders, warnings := encoders.FromStrSlice(names)
+	if warnings != "" {
+		return fmt.Errorf("error determining pre-encoding: %v", warnings)
+	}
+	err = encoders.ValidatePipeline(preEncoders)
+	if err != nil {
+		return fmt.Errorf("invalid pre-encoding: %v", err)
+	}
+	target, err := utils.OpenTarget(targetFile)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	format, err := utils.DetectFormat(target)
+	if err != nil {
+		return err
+	}
+
+	// The header of a text message, with the size written out in full. Input files also
+	// record their name and mode, which aren't known here.
+	header := process.NewHeaderBytes(nil, "txt", "", 0, preEncoders, process.Metadata{})
+	headerLen := func(size int) int {
+		return len(header) - 1 + len(strconv.Itoa(size))
+	}
+	modes, err := embedder.Capacities(format, target, headerLen)
+	if err != nil {
+		return err
+	}
+
+	r := report{Target: targetFile, Format: format, PreEncoding: names}
+	for _, mode := range modes {
+		message := mode.Payload
+		if message != embedder.Unlimited {
+			message, err = encoders.MaxInputSize(preEncoders, mode.Payload)
+			if err != nil {
+				return err
+			}
+		}
+		r.Modes = append(r.Modes, modeReport{mode, message})
+	}
+	if len(preEncoders) == 0 && modes[0].Payload != embedder.Unlimited {
+		for _, name := range encoders.Names() {
+			e, ok := encoders.ByName(name)
+			if !ok || encoders.IsCompression(e) {
+				// Parameterized encoders need a parameter, and compression depends on the message
+				continue
+			}
+			message, err := encoders.MaxInputSize([]encoders.Encoder{e}, modes[0].Payload)
+			if err != nil {
+				return err
+			}
+			r.Encoders = append(r.Encoders, encoderReport{name, message})
+		}
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	printReport(r)
+	return nil
+}
+
+// printReport prints the report as a table, followed by the frames of each mode that has them
+// and the message size with each pre-encoder
+func printReport(r report) {
+	fmt.Printf("%s (%s)\n\n", r.Target, r.Format)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "MODE\tRAW\tHEADER\tPAYLOAD\tMESSAGE\t")
+	for _, mode := range r.Modes {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t\n", mode.Mode, bytesString(mode.Raw), mode.Header, bytesString(mode.Payload), bytesString(mode.Message))
+	}
+	w.Flush()
+	for _, mode := range r.Modes {
+		if len(mode.Frames) > 1 {
+			frames := make([]string, len(mode.Frames))
+			for i, f := range mode.Frames {
+				frames[i] = strconv.Itoa(f)
+			}
+			fmt.Printf("\n%s bytes per frame: %s\n", mode.Mode, strings.Join(frames, ", "))
+		}
+	}
+	if len(r.PreEncoding) > 0 {
+		fmt.Printf("\nMESSAGE is the largest message that fits once pre-encoded with %s\n", strings.Join(r.PreEncoding, ", "))
+	}
+	if len(r.Encoders) > 0 {
+		fmt.Printf("\nlargest message in %s mode with each pre-encoder:\n", r.Modes[0].Mode)
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, e := range r.Encoders {
+			fmt.Fprintf(w, "%s\t%d\t\n", e.Name, e.Message)
+		}
+		w.Flush()
+	}
+	fmt.Println("\nall sizes are in bytes, and every byte takes up a whole pixel or sample, so there is no other bit depth")
+	fmt.Println("headers are sized for a message given as text or on stdin, an input file also records its name and mode")
+	fmt.Println("compression is left out since what it saves depends on the message")
+}
+
+func bytesString(n int) string {
+	if n == embedder.Unlimited {
+		return "unlimited"
+	}
+	return strconv.Itoa(n)
+}
@@ -2,12 +2,18 @@ package embed
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bshore/steggo/pkg/embedder"
 	"github.com/bshore/steggo/pkg/encoders"
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/tarball"
 	"github.com/bshore/steggo/pkg/utils"
 
 	"github.com/spf13/cobra"
@@ -20,72 +26,331 @@ var Cmd = &cobra.Command{
 }
 
 var (
-	targetFile      string
+	targetFiles     []string
 	destinationPath string
-	inputStr        string
+	inputs          []string
 	preEncoding     []string
+	mode            string
+	zipOutput       bool
+	chroma          bool
+	zipField        string
+	jitter          bool
+	gifMode         string
+	tarGzip         bool
+	output          string
+	pad             string
+	noise           bool
+	noiseKey        string
+	layerArgs       []string
+	shares          int
+	threshold       int
+	timestamp       bool
+	expires         string
+	sender          string
+	contentType     string
+	tags            []string
 )
 
-const preEncodingHelp = `(Optional) A comma separated list of pre-encoders to apply before embedding, 5 max: r13, b16, b32, b64, b85, gzip.
-Each encoder is applied in the order they are specified.
+const preEncodingHelp = `(Optional) A comma separated list of pre-encoders to apply before embedding: %s, auto.
+Each encoder is applied in the order they are specified, and undone in reverse order on extract.
 
-NOTE: The gzip option compresses the message and may not be used with other encoders.
+NOTE: gzip, deflate, zlib and lzw compress the message, so they're most effective as the first encoder,
+and fail when they would make the message larger. auto picks whichever of deflate, zlib and lzw
+compresses the message the most, or skips compression when none of them help.
+A pipeline compresses at most once, before any encoder but r13, and never applies r13 twice in a row.
+basen:<alphabet> encodes the message as a number written with the given characters, e.g. basen:ACGT.
+The alphabet takes the rest of the list, commas included, so basen comes last or in its own --pre-encoding.
+`
+
+const inputHelp = `The input path or message to embed into the target file.
+A directory, or more than one --input path, is packed into a tar archive before embedding. - reads the input from stdin.
+`
+
+const layerHelp = `(Optional) Embed a message only readable with its passphrase, as passphrase:input, instead of --input.
+Repeat it for up to 4 layers, each with its own passphrase, which steggo extract --passphrase reads back one at a time.
+`
+
+const targetHelp = `The path to the image file being targeted for embedding, - for stdin.
+Repeat it to split the message across several targets, which steggo extract reads back from all of them.
+`
+
+const expiresHelp = `(Optional) When the message expires, after which steggo extract refuses it without --ignore-expiry.
+Either a time from now, e.g. 72h or 7d, a date, e.g. 2026-01-31, or an RFC 3339 time.
+`
+
+const gifModeHelp = `(Optional) For GIF targets, where to embed the message: palette, index.
+palette embeds the message in the palette colors, holding up to 256 bytes per palette.
+index embeds the message in the pixels, swapping colors with their closest neighbour by brightness.
+`
+
+const modeHelp = `(Optional) How the message is stored in the target file: lsb, append.
+lsb embeds the message in the least significant bits of the image.
+append writes the message after the end of the image data, keeping the original format.
 `
 
 func InitCmd() {
-	Cmd.PersistentFlags().StringVarP(&targetFile, "target", "t", "", "The path to the image file being targeted for embedding")
+	Cmd.PersistentFlags().StringArrayVarP(&targetFiles, "target", "t", []string{}, targetHelp)
 	Cmd.PersistentFlags().StringVarP(&destinationPath, "dest", "d", ".", "The destination path to output the target file after embedding")
-	Cmd.PersistentFlags().StringVarP(&inputStr, "input", "i", "", "The input path or message to embed into the target file")
-	Cmd.PersistentFlags().StringSliceVarP(&preEncoding, "pre-encoding", "p", []string{}, preEncodingHelp)
+	Cmd.PersistentFlags().StringVarP(&output, "output", "o", "", "(Optional) The file to write the output to instead of a generated name in --dest, - for stdout")
+	Cmd.PersistentFlags().StringArrayVarP(&inputs, "input", "i", []string{}, inputHelp)
+	Cmd.PersistentFlags().StringArrayVarP(&preEncoding, "pre-encoding", "p", []string{}, fmt.Sprintf(preEncodingHelp, strings.Join(encoders.Names(), ", ")))
+	Cmd.PersistentFlags().StringVarP(&mode, "mode", "m", embedder.ModeLSB, modeHelp)
+	Cmd.PersistentFlags().BoolVar(&chroma, "chroma", false, "(Optional) For Y4M video targets, continue into the chroma planes once the luma planes are full")
+	Cmd.PersistentFlags().StringVar(&zipField, "zip-field", embedder.ZipFieldExtra, "(Optional) For ZIP based targets (.zip, .jar, .docx), where to store the message: extra, comment")
+	Cmd.PersistentFlags().StringVar(&gifMode, "gif-mode", embedder.GIFModePalette, gifModeHelp)
+	Cmd.PersistentFlags().BoolVar(&jitter, "jitter", false, "(Optional) For MIDI targets, continue into note timing once the note velocities are full")
+	Cmd.PersistentFlags().StringVar(&pad, "pad", "", "(Optional) Pad the payload up to a size bucket to hide the message length: pow2, or a size in bytes")
+	Cmd.PersistentFlags().BoolVar(&noise, "noise", false, "(Optional) For png, jpeg, bmp and y4m targets, fill the capacity left after the message with random noise")
+	Cmd.PersistentFlags().StringVar(&noiseKey, "noise-key", "", "(Optional) Derive the padding and noise from this key instead of a random source")
+	Cmd.PersistentFlags().IntVar(&shares, "shares", 0, "(Optional) Split the message into this many secret shares, one per --target")
+	Cmd.PersistentFlags().IntVar(&threshold, "threshold", 0, "(Optional) The number of shares needed to recover the message, the rest of them reveal nothing about it")
+	Cmd.PersistentFlags().StringArrayVar(&layerArgs, "layer", []string{}, layerHelp)
+	Cmd.PersistentFlags().BoolVar(&timestamp, "timestamp", false, "(Optional) Record the time the message was embedded")
+	Cmd.PersistentFlags().StringVar(&expires, "expires", "", expiresHelp)
+	Cmd.PersistentFlags().StringVar(&sender, "sender", "", "(Optional) A label recording who sent the message")
+	Cmd.PersistentFlags().StringVar(&contentType, "content-type", "", "(Optional) The content type of the message, e.g. application/pdf")
+	Cmd.PersistentFlags().StringArrayVar(&tags, "tag", []string{}, "(Optional) A key=value tag to record with the message, repeat it for more tags")
+	Cmd.PersistentFlags().BoolVar(&tarGzip, "tar-gzip", false, "(Optional) Gzip compress the tar archive that directories and multiple inputs are packed into")
+	Cmd.PersistentFlags().BoolVar(&zipOutput, "zip", false, "(Optional) In append mode, write the message as a ZIP archive so the output also opens with unzip")
 }
 
 func embedCmdFn(command *cobra.Command, args []string) (err error) {
-	input, srcType, err := getInputString(inputStr)
+	var input []byte
+	var info os.FileInfo
+	var layers []embedder.Layer
+	packed := isPackedInput(inputs)
+	if len(layerArgs) > 0 {
+		if len(inputs) > 0 {
+			return fmt.Errorf("--input can't be combined with --layer, give each layer its own input")
+		}
+		layers, err = getLayers(layerArgs)
+	} else if packed {
+		input, err = tarball.Pack(inputs, tarGzip)
+	} else {
+		input, info, err = getInput(strings.Join(inputs, ""))
+	}
 	if err != nil {
 		return err
 	}
 
-	target, err := os.Open(targetFile)
-	if err != nil {
-		return fmt.Errorf("failed to open target file %s: %v", targetFile, err)
+	if len(targetFiles) == 0 {
+		return fmt.Errorf("--target is required")
+	}
+	if slices.Contains(targetFiles, utils.Stdio) && (slices.Contains(inputs, utils.Stdio) || slices.ContainsFunc(layerArgs, isStdinLayer)) {
+		return fmt.Errorf("--input and --target can't both be read from stdin")
+	}
+	if len(targetFiles) > 1 {
+		if len(layers) > 0 {
+			return fmt.Errorf("--layer can't be combined with several targets")
+		}
+		if output != "" {
+			return fmt.Errorf("--output can't be used with several targets, each one is written to --dest")
+		}
+	}
+	if shares > 0 || threshold > 0 {
+		if shares != len(targetFiles) {
+			return fmt.Errorf("--shares %d needs one --target per share, %d given", shares, len(targetFiles))
+		}
+		if threshold < 2 || threshold > shares {
+			return fmt.Errorf("--threshold must be between 2 and --shares")
+		}
+	}
+	var carriers []embedder.Carrier
+	for i, targetFile := range targetFiles {
+		if targetFile == utils.Stdio && slices.Contains(targetFiles[i+1:], utils.Stdio) {
+			return fmt.Errorf("only one --target can be read from stdin")
+		}
+		target, err := utils.OpenTarget(targetFile)
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		targetName := targetFile
+		if targetFile == utils.Stdio {
+			targetName = "stdin"
+		}
+		carriers = append(carriers, embedder.Carrier{
+			Target:      target,
+			SrcFilename: getBaseFilename(targetName),
+			TargetExt:   filepath.Ext(targetName),
+		})
 	}
-	defer target.Close()
 
-	if !utils.DestinationExists(destinationPath) {
+	if output == "" && !utils.DestinationExists(destinationPath) {
 		return fmt.Errorf("destination path (--dest) does not exist")
 	}
 
-	preEncoders, warnings := encoders.FromStrSlice(preEncoding)
+	preEncoders, warnings := encoders.FromStrSlice(encoders.SplitNames(preEncoding))
 	if warnings != "" {
 		return fmt.Errorf("error determining pre-encoding: %v", warnings)
 	}
-	if len(preEncoders) > 5 {
-		return fmt.Errorf("too many pre-encoders, limit 5")
+	err = encoders.ValidatePipeline(preEncoders)
+	if err != nil {
+		return fmt.Errorf("invalid pre-encoding: %v", err)
+	}
+
+	meta, err := getMetadata(time.Now())
+	if err != nil {
+		return err
 	}
 
-	return embedder.Process(&embedder.Config{
+	config := &embedder.Config{
 		Input:           input,
-		SrcType:         srcType,
-		SrcFilename:     getBaseFilename(target.Name()),
-		Target:          target,
+		SrcType:         "txt",
+		SrcFilename:     carriers[0].SrcFilename,
+		TargetExt:       carriers[0].TargetExt,
+		Target:          carriers[0].Target,
 		DestinationPath: destinationPath,
+		Output:          output,
 		PreEncoding:     preEncoders,
-	})
+		Mode:            mode,
+		Zip:             zipOutput,
+		Chroma:          chroma,
+		ZipField:        zipField,
+		Jitter:          jitter,
+		GIFMode:         gifMode,
+		Pad:             pad,
+		Noise:           noise,
+		NoiseKey:        noiseKey,
+		Layers:          layers,
+		Meta:            meta,
+	}
+	if len(carriers) > 1 {
+		config.Carriers = carriers
+		config.Threshold = threshold
+	}
+	if packed {
+		config.SrcType = tarball.Ext
+		if tarGzip {
+			config.SrcType = tarball.GzipExt
+		}
+	} else if info != nil {
+		config.SrcType, err = getSrcType(info.Name())
+		if err != nil {
+			return err
+		}
+		config.InputName = getBaseFilename(info.Name())
+		config.InputMode = info.Mode().Perm()
+	}
+	return embedder.Process(config)
 }
 
-// getInputString determines if the input is either a string or another file
-func getInputString(str string) (out, srcType string, err error) {
-	info, err := os.Stat(inputStr)
-	if err != nil {
-		return str, "txt", nil
+// getMetadata builds the message metadata from the metadata flags
+func getMetadata(now time.Time) (meta process.Metadata, err error) {
+	if timestamp {
+		meta.Created = now
+	}
+	if expires != "" {
+		meta.Expires, err = parseExpiry(expires, now)
+		if err != nil {
+			return meta, err
+		}
+	}
+	meta.Sender = sender
+	meta.ContentType = contentType
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return meta, fmt.Errorf("invalid --tag %q, expected key=value", tag)
+		}
+		meta.Tags = append(meta.Tags, [2]string{key, value})
+	}
+	return meta, nil
+}
+
+// parseExpiry reads an expiry given as a time from now, a date or an RFC 3339 time
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return now.AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		// A date expires at the end of that day
+		return t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --expires %q, expected a time from now such as 72h or 7d, a date or an RFC 3339 time", s)
+}
+
+// getLayers reads each passphrase:input pair into a layer, the input being a path,
+// a message or - for stdin the same as --input
+func getLayers(args []string) ([]embedder.Layer, error) {
+	var layers []embedder.Layer
+	for _, arg := range args {
+		passphrase, in, ok := strings.Cut(arg, ":")
+		if !ok || passphrase == "" {
+			return nil, fmt.Errorf("invalid --layer %q, expected passphrase:input", arg)
+		}
+		input, info, err := getInput(in)
+		if err != nil {
+			return nil, err
+		}
+		layer := embedder.Layer{Passphrase: passphrase, Input: input, SrcType: "txt"}
+		if info != nil {
+			layer.SrcType, err = getSrcType(info.Name())
+			if err != nil {
+				return nil, err
+			}
+			layer.InputName = getBaseFilename(info.Name())
+			layer.InputMode = info.Mode().Perm()
+		}
+		layers = append(layers, layer)
 	}
-	contents, err := os.ReadFile(str)
+	return layers, nil
+}
+
+// isStdinLayer reports whether a passphrase:input pair reads its input from stdin
+func isStdinLayer(arg string) bool {
+	_, in, _ := strings.Cut(arg, ":")
+	return in == utils.Stdio
+}
+
+// isPackedInput reports whether the inputs need packing into a tar archive: a directory,
+// or several paths at once
+func isPackedInput(inputs []string) bool {
+	if len(inputs) > 1 {
+		return true
+	}
+	if len(inputs) == 1 {
+		info, err := os.Stat(inputs[0])
+		return err == nil && info.IsDir()
+	}
+	return false
+}
+
+// getInput determines if the input is either a string, stdin or another file, reading
+// files as raw bytes so binary input is embedded unchanged. The file info is nil
+// for text and stdin input.
+func getInput(str string) (out []byte, info os.FileInfo, err error) {
+	if str == utils.Stdio {
+		out, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading input from stdin: %v", err)
+		}
+		return out, nil, nil
+	}
+	info, err = os.Stat(str)
+	if err != nil || info.IsDir() {
+		return []byte(str), nil, nil
+	}
+	out, err = os.ReadFile(str)
 	if err != nil {
-		return "", "", fmt.Errorf("error reading %s: %v", str, err)
+		return nil, nil, fmt.Errorf("error reading %s: %v", str, err)
 	}
-	srcType = filepath.Ext(info.Name())
-	out = string(contents)
-	return out, srcType, nil
+	return out, info, nil
+}
+
+// getSrcType returns the extension of the input file, which the header records as its type
+func getSrcType(path string) (string, error) {
+	srcType := filepath.Ext(path)
+	return srcType, process.CheckSrcType(srcType)
 }
 
 func getBaseFilename(path string) string {
@@ -2,9 +2,11 @@ package extract
 
 import (
 	"fmt"
-	"os"
+	"io"
+	"slices"
 
 	"github.com/bshore/steggo/pkg/extractor"
+	"github.com/bshore/steggo/pkg/utils"
 
 	"github.com/spf13/cobra"
 )
@@ -16,23 +18,55 @@ var Cmd = &cobra.Command{
 }
 
 var (
-	targetFile      string
+	targetFiles     []string
 	destinationPath string
+	name            string
+	list            bool
+	output          string
+	passphrase      string
+	ignoreExpiry    bool
+	force           bool
 )
 
 func InitCmd() {
-	Cmd.PersistentFlags().StringVarP(&targetFile, "target", "t", "", "The path to the image file being targeted for extraction")
-	Cmd.PersistentFlags().StringVarP(&destinationPath, "dest", "d", "", "The destination path to output the extracted message (message.txt)")
+	Cmd.PersistentFlags().StringArrayVarP(&targetFiles, "target", "t", []string{}, "The path to the image file being targeted for extraction, - for stdin. Repeat it, in any order, for a message split across several targets")
+	Cmd.PersistentFlags().StringVarP(&destinationPath, "dest", "d", "", "The destination path to output the extracted message, named after the embedded file or message.txt")
+	Cmd.PersistentFlags().StringVarP(&name, "name", "n", "", "(Optional) The file name to write the extracted message to in --dest, overriding the embedded name")
+	Cmd.PersistentFlags().StringVarP(&output, "output", "o", "", "(Optional) The file to write the extracted message to as-is, - for stdout")
+	Cmd.PersistentFlags().StringVar(&passphrase, "passphrase", "", "(Optional) Extract the layer embedded with --layer under this passphrase")
+	Cmd.PersistentFlags().BoolVar(&ignoreExpiry, "ignore-expiry", false, "(Optional) Extract the message even when its expiry time has passed")
+	Cmd.PersistentFlags().BoolVar(&force, "force", false, "(Optional) Replace files that already exist in --dest instead of refusing to extract over them")
+	Cmd.PersistentFlags().BoolVarP(&list, "list", "l", false, "(Optional) List the embedded file, or the contents of an embedded directory, without writing anything")
 }
 
 func extractCmdFn(command *cobra.Command, args []string) (err error) {
-	target, err := os.Open(targetFile)
-	if err != nil {
-		return fmt.Errorf("failed to open target file %s: %v", targetFile, err)
+	if len(targetFiles) == 0 {
+		return fmt.Errorf("--target is required")
 	}
-	defer target.Close()
-	return extractor.Process(&extractor.Config{
-		Target:          target,
+	var targets []io.ReadSeeker
+	for i, targetFile := range targetFiles {
+		if targetFile == utils.Stdio && slices.Contains(targetFiles[i+1:], utils.Stdio) {
+			return fmt.Errorf("only one --target can be read from stdin")
+		}
+		target, err := utils.OpenTarget(targetFile)
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		targets = append(targets, target)
+	}
+	config := &extractor.Config{
+		Target:          targets[0],
 		DestinationPath: destinationPath,
-	})
+		Name:            name,
+		List:            list,
+		Output:          output,
+		Passphrase:      passphrase,
+		IgnoreExpiry:    ignoreExpiry,
+		Force:           force,
+	}
+	if len(targets) > 1 {
+		config.Targets = targets
+	}
+	return extractor.Process(config)
 }
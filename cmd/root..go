@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"github.com/bshore/steggo/cmd/capacity"
 	"github.com/bshore/steggo/cmd/embed"
 	"github.com/bshore/steggo/cmd/extract"
+	"github.com/bshore/steggo/cmd/scan"
+	"github.com/bshore/steggo/cmd/wipe"
 
 	"github.com/spf13/cobra"
 )
@@ -12,6 +15,9 @@ Try subcommands:
 
 steggo embed --help
 steggo extract --help
+steggo wipe --help
+steggo capacity --help
+steggo scan --help
 `
 
 var rootCmd = &cobra.Command{
@@ -31,4 +37,13 @@ func InitRoot() {
 
 	extract.InitCmd()
 	rootCmd.AddCommand(extract.Cmd)
+
+	wipe.InitCmd()
+	rootCmd.AddCommand(wipe.Cmd)
+
+	capacity.InitCmd()
+	rootCmd.AddCommand(capacity.Cmd)
+
+	scan.InitCmd()
+	rootCmd.AddCommand(scan.Cmd)
 }
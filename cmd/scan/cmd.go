@@ -0,0 +1,49 @@
+package scan
+
+import (
+	"runtime"
+
+	"github.com/bshore/steggo/pkg/scanner"
+	"github.com/bshore/steggo/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "scan <paths...>",
+	Short: "Scans files and directories for embedded messages, reporting the headers found",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  scanCmdFn,
+}
+
+// Exit statuses of the scan, 1 being left for errors that stop it altogether
+const (
+	exitFound  utils.ExitCode = 2
+	exitFailed utils.ExitCode = 3
+)
+
+var workers int
+
+func InitCmd() {
+	Cmd.PersistentFlags().IntVarP(&workers, "workers", "w", runtime.NumCPU(), "(Optional) The number of files to scan at once")
+}
+
+func scanCmdFn(command *cobra.Command, args []string) error {
+	summary := scanner.Process(&scanner.Config{
+		Paths:   args,
+		Workers: workers,
+	})
+	var code utils.ExitCode
+	switch {
+	case summary.Found > 0:
+		code = exitFound
+	case summary.Failed > 0:
+		code = exitFailed
+	default:
+		return nil
+	}
+	// The exit status carries the result, which isn't an error worth printing
+	command.SilenceErrors = true
+	command.SilenceUsage = true
+	return code
+}
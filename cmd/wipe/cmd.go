@@ -0,0 +1,50 @@
+package wipe
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/bshore/steggo/pkg/utils"
+	"github.com/bshore/steggo/pkg/wiper"
+
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "wipe",
+	Short: "Wipes the embedded message from --target {file}, overwriting it in place",
+	RunE:  wipeCmdFn,
+}
+
+var (
+	targetFile string
+	output     string
+	all        bool
+)
+
+func InitCmd() {
+	Cmd.PersistentFlags().StringVarP(&targetFile, "target", "t", "", "The path to the file to wipe the embedded message from, - for stdin")
+	Cmd.PersistentFlags().StringVarP(&output, "output", "o", "", "(Optional) The file to write the wiped file to instead of overwriting --target, - for stdout")
+	Cmd.PersistentFlags().BoolVar(&all, "all", false, "(Optional) Wipe the whole capacity of the file instead of only the region holding the message")
+}
+
+func wipeCmdFn(command *cobra.Command, args []string) (err error) {
+	if targetFile == "" {
+		return fmt.Errorf("--target is required")
+	}
+	target, err := utils.OpenTarget(targetFile)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	if output == "" {
+		// The target itself is replaced, or stdout for a target read from stdin
+		output = targetFile
+	}
+	return wiper.Process(&wiper.Config{
+		Target: target,
+		Output: output,
+		All:    all,
+		Random: rand.Reader,
+	})
+}
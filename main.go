@@ -1,15 +1,22 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 
 	"github.com/bshore/steggo/cmd"
+	"github.com/bshore/steggo/pkg/utils"
 )
 
 func main() {
 	cmd.InitRoot()
-	if err := cmd.Execute(os.Args[1:]); err != nil {
+	err := cmd.Execute(os.Args[1:])
+	var code utils.ExitCode
+	if errors.As(err, &code) {
+		os.Exit(int(code))
+	}
+	if err != nil {
 		log.Printf("exiting with error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,41 @@
+package embedder
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessAppend writes the carrier up to its logical end followed by the message container,
+// leaving the carrier's own bytes untouched. When asZip is set the container is written as a
+// ZIP archive so the output is also a valid .zip file.
+func ProcessAppend(header, msg []byte, srcType, format string, asZip bool, dest io.Writer, src io.Reader) error {
+	carrier, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("error reading %s file: %v", format, err)
+	}
+	end, err := process.LogicalEnd(carrier, format)
+	if err != nil {
+		return fmt.Errorf("error locating end of %s file: %v", format, err)
+	}
+	carrier = carrier[:end]
+
+	var trailer []byte
+	if asZip {
+		name := "message." + strings.TrimPrefix(srcType, ".")
+		trailer, err = process.FinalizeZipTrailer(int64(len(carrier)), name, header, msg)
+		if err != nil {
+			return fmt.Errorf("error building zip trailer: %v", err)
+		}
+	} else {
+		trailer = process.FinalizeTrailer(header, msg)
+	}
+
+	_, err = dest.Write(append(carrier, trailer...))
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package embedder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/bshore/steggo/pkg/giffile"
+	"github.com/bshore/steggo/pkg/ico"
+	"github.com/bshore/steggo/pkg/midi"
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/y4m"
+	"github.com/bshore/steggo/pkg/ziparchive"
+)
+
+// MessageCapacity returns the number of message bytes the target can hold in lsb mode once
+// a header of headerLen bytes is embedded alongside it. ICO/CUR targets spend one header
+// per image, since every image holds its own piece of the message.
+func MessageCapacity(format string, config *Config, headerLen int, src io.Reader) (int, error) {
+	var capacity int
+	switch format {
+	case "png", "jpeg", "bmp":
+		loaded, _, err := image.Decode(src)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding %s file: %v", format, err)
+		}
+		capacity = process.ImageCapacity(loaded)
+	case "gif":
+		loaded, err := giffile.Decode(src)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding GIF file: %v", err)
+		}
+		if config.GIFMode == GIFModeIndex {
+			capacity, err = process.GIFIndexCapacity(loaded)
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+		process.PadGIFPalettes(loaded)
+		plan, err := process.PlanGIFCapacity(loaded)
+		if err != nil {
+			return 0, err
+		}
+		capacity = process.GIFCapacityBytes(plan)
+	case "ico", "cur":
+		loaded, err := ico.Decode(src)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding ICO file: %v", err)
+		}
+		for i := range loaded.Entries {
+			img, err := loaded.Entries[i].Image()
+			if err != nil {
+				return 0, fmt.Errorf("error decoding icon image %d: %v", i, err)
+			}
+			capacity += max(process.ImageCapacity(img)-headerLen, 0)
+		}
+		return capacity, nil
+	case "y4m":
+		loaded, err := y4m.Decode(src)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding Y4M file: %v", err)
+		}
+		for _, c := range process.Y4MFrameCapacity(loaded, config.Chroma) {
+			capacity += c
+		}
+	case "zip":
+		loaded, err := ziparchive.Decode(src)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding ZIP file: %v", err)
+		}
+		if config.ZipField == ZipFieldComment {
+			comment := loaded.Comment
+			if idx := bytes.Index(comment, []byte(process.TrailerMagic)); idx >= 0 {
+				comment = comment[:idx]
+			}
+			capacity = ziparchive.MaxFieldLen - len(comment)
+		} else {
+			capacity = process.ZipExtraCapacity(loaded)
+		}
+		capacity -= len(process.TrailerMagic)
+	case "mid":
+		loaded, err := midi.Decode(src)
+		if err != nil {
+			return 0, fmt.Errorf("error decoding MIDI file: %v", err)
+		}
+		capacity = process.MIDICapacity(loaded, config.Jitter)
+	default:
+		return 0, fmt.Errorf("unsupported source file format: %v", format)
+	}
+	return max(capacity-headerLen, 0), nil
+}
+
+// Unlimited is the capacity of append mode, which has no limit
+const Unlimited = -1
+
+// ModeCapacity is how much a target holds when embedded into in one particular way
+type ModeCapacity struct {
+	// Mode names the way of embedding, e.g. lsb, index or chroma
+	Mode string `json:"mode"`
+	// Raw is the number of bytes the carrier holds, header included, or Unlimited
+	Raw int `json:"raw"`
+	// Header is the number of those bytes taken up by the header
+	Header int `json:"header"`
+	// Payload is the number of message bytes left once the header is embedded, or Unlimited
+	Payload int `json:"payload"`
+	// Frames holds the raw capacity of each frame or image, for formats made of several
+	Frames []int `json:"frames,omitempty"`
+}
+
+// newModeCapacity fills in the header and payload of a mode holding raw bytes
+func newModeCapacity(mode string, raw int, headerLen func(size int) int, frames []int) ModeCapacity {
+	payload := maxPayload(raw, headerLen)
+	return ModeCapacity{Mode: mode, Raw: raw, Header: headerLen(payload), Payload: payload, Frames: frames}
+}
+
+// maxPayload returns the largest message that fits in raw bytes along with its header. The
+// header records the message's size, so it can be shorter than the header of raw bytes.
+func maxPayload(raw int, headerLen func(size int) int) int {
+	payload := max(raw-headerLen(raw), 0)
+	for payload+1+headerLen(payload+1) <= raw {
+		payload++
+	}
+	return payload
+}
+
+// appendCapacity is the capacity of append mode, which only adds the trailer magic to the header
+func appendCapacity(headerLen func(size int) int) ModeCapacity {
+	return ModeCapacity{Mode: ModeAppend, Raw: Unlimited, Header: len(process.TrailerMagic) + headerLen(0), Payload: Unlimited}
+}
+
+// Capacities reports the capacity of the target for every way its format can be embedded
+// into, the default way first. headerLen returns the length of the header for a message of
+// the given size.
+func Capacities(format string, src io.Reader, headerLen func(size int) int) ([]ModeCapacity, error) {
+	switch format {
+	case "png", "jpeg", "bmp":
+		loaded, _, err := image.Decode(src)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s file: %v", format, err)
+		}
+		return []ModeCapacity{
+			newModeCapacity(ModeLSB, process.ImageCapacity(loaded), headerLen, nil),
+			newModeCapacity("layer", process.LayerCapacity(loaded), headerLen, nil),
+			appendCapacity(headerLen),
+		}, nil
+	case "gif":
+		loaded, err := giffile.Decode(src)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding GIF file: %v", err)
+		}
+		// Work out the index capacity before padding, which adds palette entries no pixel uses
+		indexRaw, err := process.GIFIndexCapacity(loaded)
+		if err != nil {
+			return nil, err
+		}
+		process.PadGIFPalettes(loaded)
+		plan, err := process.PlanGIFCapacity(loaded)
+		if err != nil {
+			return nil, err
+		}
+		frames := make([]int, len(plan))
+		for i, frameCap := range plan {
+			frames[i] = frameCap.Capacity / 8
+		}
+		return []ModeCapacity{
+			newModeCapacity(GIFModePalette, process.GIFCapacityBytes(plan), headerLen, frames),
+			newModeCapacity(GIFModeIndex, indexRaw, headerLen, nil),
+			appendCapacity(headerLen),
+		}, nil
+	case "ico", "cur":
+		loaded, err := ico.Decode(src)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding ICO file: %v", err)
+		}
+		mode := ModeCapacity{Mode: ModeLSB}
+		for i := range loaded.Entries {
+			img, err := loaded.Entries[i].Image()
+			if err != nil {
+				return nil, fmt.Errorf("error decoding icon image %d: %v", i, err)
+			}
+			raw := process.ImageCapacity(img)
+			mode.Raw += raw
+			mode.Frames = append(mode.Frames, raw)
+		}
+		// Every image holds its own shard header, sized for the whole message, along with
+		// its piece of the message
+		n := len(loaded.Entries)
+		shard := process.Shard{Set: strings.Repeat("0", 16), Index: n, Total: n, Checksum: math.MaxUint32}
+		overhead := len(process.NewShardHeaderBytes(nil, "txt", "", 0, nil, process.Metadata{}, shard)) -
+			len(process.NewHeaderBytes(nil, "txt", "", 0, nil, process.Metadata{}))
+		imageHeaderLen := func(payload int) int {
+			return headerLen(payload) + overhead
+		}
+		fits := func(payload int) bool {
+			room := 0
+			for _, raw := range mode.Frames {
+				room += max(raw-imageHeaderLen(payload), 0)
+			}
+			return room >= payload
+		}
+		for fits(mode.Payload + 1) {
+			mode.Payload++
+		}
+		for _, raw := range mode.Frames {
+			mode.Header += min(imageHeaderLen(mode.Payload), raw)
+		}
+		return []ModeCapacity{mode}, nil
+	case "y4m":
+		loaded, err := y4m.Decode(src)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding Y4M file: %v", err)
+		}
+		var modes []ModeCapacity
+		for _, chroma := range []bool{false, true} {
+			frames := process.Y4MFrameCapacity(loaded, chroma)
+			var raw int
+			for _, c := range frames {
+				raw += c
+			}
+			name := "luma"
+			if chroma {
+				name = "chroma"
+			}
+			modes = append(modes, newModeCapacity(name, raw, headerLen, frames))
+		}
+		return modes, nil
+	case "zip":
+		var modes []ModeCapacity
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ZIP file: %v", err)
+		}
+		for _, field := range []string{ZipFieldExtra, ZipFieldComment} {
+			// The header's own length doesn't change the room, so measure it without one
+			raw, err := MessageCapacity(format, &Config{ZipField: field}, 0, bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			modes = append(modes, newModeCapacity(field, raw, headerLen, nil))
+		}
+		return modes, nil
+	case "mid":
+		loaded, err := midi.Decode(src)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding MIDI file: %v", err)
+		}
+		return []ModeCapacity{
+			newModeCapacity("velocity", process.MIDICapacity(loaded, false), headerLen, nil),
+			newModeCapacity("jitter", process.MIDICapacity(loaded, true), headerLen, nil),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported source file format: %v", format)
+}
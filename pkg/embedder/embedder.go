@@ -1,64 +1,189 @@
 package embedder
 
 import (
+	"bytes"
 	"fmt"
-	"image"
 	"io"
+	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/bshore/steggo/pkg/encoders"
 	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/utils"
+)
+
+const (
+	// ModeLSB embeds the message into the least significant bits of the carrier
+	ModeLSB = "lsb"
+	// ModeAppend writes the message after the logical end of the carrier
+	ModeAppend = "append"
 )
 
 type Config struct {
-	Input           string
+	Input           []byte
 	SrcType         string
+	InputName       string
+	InputMode       os.FileMode
 	SrcFilename     string
+	TargetExt       string
 	Target          io.ReadSeeker
 	DestinationPath string
-	PreEncoding     []encoders.EncType
+	PreEncoding     []encoders.Encoder
+	Mode            string
+	Zip             bool
+	Chroma          bool
+	ZipField        string
+	Jitter          bool
+	GIFMode         string
+	// Output overrides the file the result is written to, - writes it to stdout
+	Output string
+	// Pad is the size bucket the payload is padded up to, empty for no padding
+	Pad string
+	// Noise fills the capacity left after the payload with noise
+	Noise bool
+	// NoiseKey derives the padding and noise from a key instead of crypto/rand
+	NoiseKey string
+	// Layers embeds several passphrase protected messages instead of Input
+	Layers []Layer
+	// Carriers splits the message across several targets instead of Target
+	Carriers []Carrier
+	// Threshold embeds a secret share in each carrier instead of a piece of the message,
+	// any Threshold of which recover it
+	Threshold int
+	// Meta is the optional metadata recorded in the header
+	Meta process.Metadata
 }
 
 func Process(config *Config) error {
-	// Compression is not allowed with any other encoding
-	if len(config.PreEncoding) > 1 && slices.Contains(config.PreEncoding, encoders.GZIP) {
-		return fmt.Errorf("compression must not be used with any other pre-encoding")
+	if len(config.Layers) > 0 {
+		format, err := utils.DetectFormat(config.Target)
+		if err != nil {
+			return err
+		}
+		return processLayers(config, format)
 	}
 	// Print a before and after pre-encoding along with the size increase/decrease of the message.
 	// sizeBefore := len(config.Input)
 	// fmt.Printf("Before pre-encoding: %d bytes\n", sizeBefore)
-	processedInput, err := encoders.ApplyPreEncoding(config.Input, config.PreEncoding)
+	processedInput, applied, err := encoders.ApplyPreEncoding(config.Input, config.PreEncoding)
 	if err != nil {
 		return fmt.Errorf("failed to apply pre-encoding: %v", err)
 	}
+	// Record the encoders actually applied, with auto resolved to the codec it chose
+	config.PreEncoding = applied
 	// fmt.Printf("After pre-encoding: %d bytes, total size change: %d%%\n", len(processedInput), (len(processedInput)-sizeBefore)*100/sizeBefore)
 
-	_, format, err := image.Decode(config.Target)
+	if len(config.Carriers) > 0 {
+		return processShards(config, processedInput)
+	}
+
+	format, err := utils.DetectFormat(config.Target)
 	if err != nil {
-		return fmt.Errorf("failed to decode target file: %v", err)
+		return err
+	}
+
+	header := process.NewHeaderBytes(processedInput, config.SrcType, config.InputName, config.InputMode, config.PreEncoding, config.Meta)
+	out, dest, err := embed(config, format, header, processedInput)
+	if err != nil {
+		return err
+	}
+	return writeOutput(out, config.Output, dest)
+}
+
+// embed embeds the header and the pre-encoded message into config.Target, returning the
+// embedded file along with the destination it's written to by default
+func embed(config *Config, format string, header, processedInput []byte) ([]byte, string, error) {
+	var err error
+	noise := process.NewNoise(config.NoiseKey)
+	if config.Pad != "" {
+		if config.Zip {
+			return nil, "", fmt.Errorf("padding is not supported with zip output, it would end up in the archive")
+		}
+		if format == "ico" || format == "cur" {
+			return nil, "", fmt.Errorf("padding is not supported for %s targets", format)
+		}
+		// Only the header and message are read back, the padding is left behind
+		processedInput, err = process.Pad(header, processedInput, config.Pad, noise)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	var fill io.Reader
+	if config.Noise {
+		if !slices.Contains([]string{"png", "jpeg", "bmp", "y4m"}, format) || config.Mode == ModeAppend {
+			return nil, "", fmt.Errorf("noise is only supported for png, jpeg, bmp and y4m targets in %s mode", ModeLSB)
+		}
+		fill = noise
 	}
-	_, _ = config.Target.Seek(0, 0)
 
-	dest := formatDestination(config.SrcFilename, config.DestinationPath, format)
-	header := process.NewHeaderBytes(processedInput, config.SrcType, config.PreEncoding)
+	switch config.Mode {
+	case "", ModeLSB:
+		if config.Zip {
+			return nil, "", fmt.Errorf("zip output is only supported in %s mode", ModeAppend)
+		}
+	case ModeAppend:
+		var out bytes.Buffer
+		err = ProcessAppend(header, processedInput, config.SrcType, format, config.Zip, &out, config.Target)
+		if err != nil {
+			return nil, "", err
+		}
+		return out.Bytes(), formatAppendDestination(config.SrcFilename, config.DestinationPath, format), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported embed mode: %v", config.Mode)
+	}
+
+	destFormat := format
+	if format == "zip" && config.TargetExt != "" {
+		// Keep .jar, .docx etc. so the archive still opens with the right application
+		destFormat = strings.TrimPrefix(config.TargetExt, ".")
+	}
+	dest := formatDestination(config.SrcFilename, config.DestinationPath, destFormat)
 	data := process.FinalizeMessage(header, processedInput)
+	// Build the output in memory so a failed embed never leaves a partial file behind
+	var out bytes.Buffer
 
 	switch format {
 	case "png":
-		err = ProcessPNG(data, dest, config.Target)
+		err = ProcessPNG(data, fill, &out, config.Target)
 	case "jpeg":
-		err = ProcessJPEG(data, dest, config.Target)
+		err = ProcessJPEG(data, fill, &out, config.Target)
 	case "bmp":
-		err = ProcessBMP(data, dest, config.Target)
+		err = ProcessBMP(data, fill, &out, config.Target)
 	case "gif":
-		err = ProcessGIF(data, dest, config.Target)
+		err = ProcessGIF(header, processedInput, config.GIFMode, &out, config.Target)
+	case "ico", "cur":
+		err = ProcessICO(processedInput, config.SrcType, config.InputName, config.InputMode, config.PreEncoding, config.Meta, &out, config.Target)
+	case "y4m":
+		err = ProcessY4M(data, config.Chroma, fill, &out, config.Target)
+	case "zip":
+		err = ProcessZip(header, processedInput, config.ZipField, &out, config.Target)
+	case "mid":
+		err = ProcessMIDI(header, processedInput, config.Jitter, &out, config.Target)
 	default:
-		return fmt.Errorf("unsupported source file format: %v", format)
+		return nil, "", fmt.Errorf("unsupported source file format: %v", format)
 	}
 	if err != nil {
+		return nil, "", err
+	}
+	return out.Bytes(), dest, nil
+}
+
+// writeOutput writes the embedded file to output, or to dest when no output was given.
+// An output of - writes it to stdout.
+func writeOutput(data []byte, output, dest string) error {
+	if output == utils.Stdio {
+		_, err := os.Stdout.Write(data)
 		return err
 	}
+	if output != "" {
+		dest = output
+	}
+	err := os.WriteFile(dest, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
 	return nil
 }
 
@@ -76,3 +201,9 @@ func formatDestination(srcFilename, path, format string) string {
 	}
 	return filepath.Join(path, fmt.Sprintf("%s_output.%s", srcFilename, format))
 }
+
+// formatAppendDestination returns output.{format} for every format, since append mode
+// never re-encodes the carrier and so can keep its original format.
+func formatAppendDestination(srcFilename, path, format string) string {
+	return filepath.Join(path, fmt.Sprintf("%s_output.%s", srcFilename, format))
+}
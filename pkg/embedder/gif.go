@@ -2,47 +2,43 @@ package embedder
 
 import (
 	"fmt"
-	"image/color"
-	"image/gif"
 	"io"
-	"os"
 
+	"github.com/bshore/steggo/pkg/giffile"
 	"github.com/bshore/steggo/pkg/process"
 )
 
-func ProcessGIF(data []byte, dest string, src io.Reader) error {
-	loaded, err := gif.DecodeAll(src)
+const (
+	// GIFModePalette embeds the message in the LSBs of the palette colors
+	GIFModePalette = "palette"
+	// GIFModeIndex embeds the message in the pixel indices of a luminance sorted palette
+	GIFModeIndex = "index"
+)
+
+// ProcessGIF embeds the message into a GIF, keeping its global color table, loop count,
+// frame delays, disposal methods, transparency, comments and application extensions.
+// Only the color tables, and in index mode the image data, are rewritten.
+func ProcessGIF(header, msg []byte, mode string, dest io.Writer, src io.Reader) error {
+	loaded, err := giffile.Decode(src)
 	if err != nil {
 		return fmt.Errorf("error decoding GIF file: %v", err)
 	}
 
-	// Convert global color table to local color tables if present
-	if loaded.Config.ColorModel != nil {
-		globalColorTable := loaded.Config.ColorModel.(color.Palette)
-		// Place the global color table as the local color table of all frames
-		for i := range loaded.Image {
-			if loaded.Image[i].Palette == nil {
-				paletteCopy := make(color.Palette, len(globalColorTable))
-				copy(paletteCopy, globalColorTable)
-				loaded.Image[i].Palette = paletteCopy
-			}
-		}
-		// Clear the global color table
-		loaded.Config.ColorModel = nil
+	switch mode {
+	case "", GIFModePalette:
+		// Palettes smaller than 256 colors get padded with unused entries for extra capacity
+		process.PadGIFPalettes(loaded)
+		err = process.EmbedMsgInGIF(process.FinalizeMessage(header, msg), loaded)
+	case GIFModeIndex:
+		err = process.EmbedMsgInGIFIndices(append(header, msg...), loaded)
+	default:
+		return fmt.Errorf("unsupported GIF mode: %v", mode)
 	}
-
-	embedded, err := process.EmbedMsgInGIF(data, loaded)
 	if err != nil {
 		return fmt.Errorf("error embedding message in file: %v", err)
 	}
 
-	newFile, err := os.Create(dest)
-	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
-	}
-	defer newFile.Close()
-
-	err = gif.EncodeAll(newFile, embedded)
+	err = giffile.Encode(dest, loaded)
 	if err != nil {
 		return fmt.Errorf("error encoding new GIF image: %v", err)
 	}
@@ -0,0 +1,83 @@
+package embedder
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+
+	"github.com/bshore/steggo/pkg/encoders"
+	"github.com/bshore/steggo/pkg/ico"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessICO treats every image in an ICO/CUR file as its own carrier, splitting the message
+// across them in proportion to their capacity. Each image gets a shard header describing its
+// piece of the message, so extraction can stitch the pieces back together and tell when one
+// is missing or cut short.
+func ProcessICO(msg []byte, srcType, name string, mode os.FileMode, preEncoding []encoders.Encoder, meta process.Metadata, dest io.Writer, src io.Reader) error {
+	loaded, err := ico.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding ICO file: %v", err)
+	}
+
+	total := len(loaded.Entries)
+	if total > process.MaxShards {
+		return fmt.Errorf("icon holds %d images, a message can be split across up to %d", total, process.MaxShards)
+	}
+	set, err := process.NewShardSet()
+	if err != nil {
+		return err
+	}
+	// The header of the whole message with the largest index is the largest any image will need
+	headerLen := len(process.NewShardHeaderBytes(msg, srcType, name, mode, preEncoding, meta, process.Shard{
+		Set:      set,
+		Index:    total,
+		Total:    total,
+		Checksum: math.MaxUint32,
+	}))
+	images := make([]image.Image, len(loaded.Entries))
+	capacities := make([]int, len(loaded.Entries))
+	for i := range loaded.Entries {
+		images[i], err = loaded.Entries[i].Image()
+		if err != nil {
+			return fmt.Errorf("error decoding icon image %d: %v", i, err)
+		}
+		capacities[i] = process.ImageCapacity(images[i]) - headerLen
+		if capacities[i] < 0 {
+			return fmt.Errorf("icon image %d (%dx%d) is too small to hold a message header", i, loaded.Entries[i].Width, loaded.Entries[i].Height)
+		}
+	}
+	sizes, err := process.DistributePayload(len(msg), capacities)
+	if err != nil {
+		return fmt.Errorf("error embedding message in file: %v", err)
+	}
+
+	checksum := process.ShardChecksum(msg)
+	var offset int
+	for i := range loaded.Entries {
+		chunk := msg[offset : offset+sizes[i]]
+		offset += sizes[i]
+		header := process.NewShardHeaderBytes(chunk, srcType, name, mode, preEncoding, meta, process.Shard{
+			Set:      set,
+			Index:    i,
+			Total:    total,
+			Checksum: checksum,
+		})
+		embedded, err := process.EmbedMsgInImage8(process.FinalizeMessage(header, chunk), images[i])
+		if err != nil {
+			return fmt.Errorf("error embedding message in icon image %d: %v", i, err)
+		}
+		err = loaded.Entries[i].SetImage(embedded, loaded.Type)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ico.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new ICO file: %v", err)
+	}
+	return nil
+}
@@ -5,27 +5,26 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
-	"os"
 
 	"github.com/bshore/steggo/pkg/process"
 )
 
-func ProcessJPEG(data []byte, dest string, src io.Reader) error {
+func ProcessJPEG(data []byte, noise io.Reader, dest io.Writer, src io.Reader) error {
 	loadedImage, err := jpeg.Decode(src)
 	if err != nil {
 		return fmt.Errorf("error decoding JPEG file: %v", err)
 	}
+	if noise != nil {
+		data, err = process.FillWithNoise(data, process.ImageCapacity(loadedImage), noise)
+		if err != nil {
+			return err
+		}
+	}
 	embedded, err := process.EmbedMsgInImage(data, loadedImage)
 	if err != nil {
 		return fmt.Errorf("error embedding message in file: %v", err)
 	}
-	newFile, err := os.Create(dest)
-	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
-	}
-	defer newFile.Close()
-
-	err = png.Encode(newFile, embedded)
+	err = png.Encode(dest, embedded)
 	if err != nil {
 		return fmt.Errorf("error encoding new JPEG image: %v", err)
 	}
@@ -0,0 +1,71 @@
+package embedder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/bshore/steggo/pkg/encoders"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// Layer is one message of a layered embed, only readable with its passphrase
+type Layer struct {
+	Passphrase string
+	Input      []byte
+	SrcType    string
+	InputName  string
+	InputMode  os.FileMode
+}
+
+// processLayers pre-encodes every layer and embeds them into the target's pixels
+func processLayers(config *Config, format string) error {
+	if config.Mode == ModeAppend || config.Zip {
+		return fmt.Errorf("layers are only supported in %s mode", ModeLSB)
+	}
+	if config.Pad != "" || config.Noise || config.NoiseKey != "" {
+		return fmt.Errorf("layers can't be combined with --pad, --noise or --noise-key, every layer is already filled with random noise")
+	}
+	if format != "png" && format != "jpeg" && format != "bmp" {
+		return fmt.Errorf("layers are only supported for png, jpeg and bmp targets")
+	}
+	var layers []process.Layer
+	for i, layer := range config.Layers {
+		processed, applied, err := encoders.ApplyPreEncoding(layer.Input, config.PreEncoding)
+		if err != nil {
+			return fmt.Errorf("failed to apply pre-encoding to layer %d: %v", i+1, err)
+		}
+		layers = append(layers, process.Layer{
+			Passphrase: layer.Passphrase,
+			Header:     process.NewHeaderBytes(processed, layer.SrcType, layer.InputName, layer.InputMode, applied, config.Meta),
+			Msg:        processed,
+		})
+	}
+	dest := formatDestination(config.SrcFilename, config.DestinationPath, format)
+	var out bytes.Buffer
+	err := ProcessLayers(layers, process.NewNoise(""), &out, config.Target)
+	if err != nil {
+		return err
+	}
+	return writeOutput(out.Bytes(), config.Output, dest)
+}
+
+// ProcessLayers embeds the layers into a png, jpeg or bmp image, writing the result as a PNG
+func ProcessLayers(layers []process.Layer, noise io.Reader, dest io.Writer, src io.Reader) error {
+	loadedImage, _, err := image.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding image file: %v", err)
+	}
+	embedded, err := process.EmbedLayers(layers, loadedImage, noise)
+	if err != nil {
+		return fmt.Errorf("error embedding layers in file: %v", err)
+	}
+	err = png.Encode(dest, embedded)
+	if err != nil {
+		return fmt.Errorf("error encoding new PNG image: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package embedder
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/midi"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessMIDI embeds the header and message into the note-on velocities of a MIDI file,
+// continuing into note timing when jitter is set
+func ProcessMIDI(header, msg []byte, jitter bool, dest io.Writer, src io.Reader) error {
+	loaded, err := midi.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding MIDI file: %v", err)
+	}
+	err = process.EmbedMsgInMIDI(append(header, msg...), loaded, jitter)
+	if err != nil {
+		return fmt.Errorf("error embedding message in file: %v", err)
+	}
+
+	err = midi.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new MIDI file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package embedder
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/utils"
+)
+
+// Carrier is one of several targets a message is split across
+type Carrier struct {
+	Target      io.ReadSeeker
+	SrcFilename string
+	TargetExt   string
+}
+
+// processShards splits the pre-encoded message across the carriers in proportion to their
+// capacity, or into secret shares when a threshold is set, embedding each piece with a shard
+// header. Every carrier is embedded before anything is written, so a message that doesn't
+// fit leaves no files behind.
+func processShards(config *Config, processedInput []byte) error {
+	if config.Pad != "" {
+		return fmt.Errorf("padding is not supported when splitting the message across several targets")
+	}
+	set, err := process.NewShardSet()
+	if err != nil {
+		return err
+	}
+	total := len(config.Carriers)
+	if total > process.MaxShards {
+		return fmt.Errorf("too many targets: %d given, a message can be split across up to %d", total, process.MaxShards)
+	}
+	formats := make([]string, total)
+	for i, carrier := range config.Carriers {
+		formats[i], err = utils.DetectFormat(carrier.Target)
+		if err != nil {
+			return err
+		}
+		if formats[i] == "ico" || formats[i] == "cur" {
+			return fmt.Errorf("%s targets already split the message across their images and can't hold a shard", formats[i])
+		}
+	}
+
+	var pieces [][]byte
+	var headers [][]byte
+	if config.Threshold > 0 {
+		pieces, headers, err = splitShares(config, processedInput, set)
+	} else {
+		pieces, headers, err = splitPieces(config, processedInput, set, formats)
+	}
+	if err != nil {
+		return err
+	}
+
+	outputs := make([][]byte, total)
+	dests := make([]string, total)
+	seen := map[string]bool{}
+	for i, carrier := range config.Carriers {
+		shardConfig := *config
+		shardConfig.Target = carrier.Target
+		shardConfig.SrcFilename = carrier.SrcFilename
+		shardConfig.TargetExt = carrier.TargetExt
+		if config.Threshold > 0 {
+			// Keep the message's type out of the name --zip gives the appended archive entry
+			shardConfig.SrcType = "bin"
+		}
+		outputs[i], dests[i], err = embed(&shardConfig, formats[i], headers[i], pieces[i])
+		if err != nil {
+			return fmt.Errorf("target %d: %v", i+1, err)
+		}
+		if seen[dests[i]] {
+			return fmt.Errorf("target %d would be written to %s, which another target already uses", i+1, dests[i])
+		}
+		seen[dests[i]] = true
+	}
+	for i := range outputs {
+		err = writeOutput(outputs[i], "", dests[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPieces cuts the message into one piece per carrier in proportion to their capacity
+func splitPieces(config *Config, processedInput []byte, set string, formats []string) ([][]byte, [][]byte, error) {
+	total := len(config.Carriers)
+	// The header of the whole message with the largest index is the largest any shard will need
+	headerLen := len(process.NewShardHeaderBytes(processedInput, config.SrcType, config.InputName, config.InputMode, config.PreEncoding, config.Meta, process.Shard{
+		Set:      set,
+		Index:    total,
+		Total:    total,
+		Checksum: math.MaxUint32,
+	}))
+	capacities := make([]int, total)
+	for i, carrier := range config.Carriers {
+		if config.Mode == ModeAppend {
+			// Appended messages have no capacity limit, so the pieces are split evenly
+			capacities[i] = len(processedInput)
+			continue
+		}
+		var err error
+		capacities[i], err = MessageCapacity(formats[i], config, headerLen, carrier.Target)
+		if err != nil {
+			return nil, nil, fmt.Errorf("target %d: %v", i+1, err)
+		}
+		_, err = carrier.Target.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, nil, fmt.Errorf("target %d: %v", i+1, err)
+		}
+	}
+	sizes, err := process.DistributePayload(len(processedInput), capacities)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checksum := process.ShardChecksum(processedInput)
+	pieces := make([][]byte, total)
+	headers := make([][]byte, total)
+	var offset int
+	for i := range config.Carriers {
+		pieces[i] = processedInput[offset : offset+sizes[i]]
+		offset += sizes[i]
+		headers[i] = process.NewShardHeaderBytes(pieces[i], config.SrcType, config.InputName, config.InputMode, config.PreEncoding, config.Meta, process.Shard{
+			Set:      set,
+			Index:    i,
+			Total:    total,
+			Checksum: checksum,
+		})
+	}
+	return pieces, headers, nil
+}
+
+// splitShares splits the message, along with its header, into one secret share per carrier.
+// The share headers leave out the message's type, name, pre-encoding and metadata, which
+// only the combined shares reveal.
+func splitShares(config *Config, processedInput []byte, set string) ([][]byte, [][]byte, error) {
+	total := len(config.Carriers)
+	header := process.NewHeaderBytes(processedInput, config.SrcType, config.InputName, config.InputMode, config.PreEncoding, config.Meta)
+	secret := append(header, processedInput...)
+	shares, err := process.SplitSecret(secret, total, config.Threshold, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers := make([][]byte, total)
+	for i := range shares {
+		headers[i] = process.NewShardHeaderBytes(shares[i], "", "", 0, nil, process.Metadata{}, process.Shard{
+			Set:       set,
+			Index:     i,
+			Total:     total,
+			Checksum:  process.ShardChecksum(shares[i]),
+			Threshold: config.Threshold,
+		})
+	}
+	return shares, headers, nil
+}
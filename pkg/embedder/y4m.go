@@ -0,0 +1,38 @@
+package embedder
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/y4m"
+)
+
+// ProcessY4M embeds the message into the luma planes of a Y4M video, spilling over
+// into the chroma planes when chroma is set
+func ProcessY4M(data []byte, chroma bool, noise io.Reader, dest io.Writer, src io.Reader) error {
+	loaded, err := y4m.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding Y4M file: %v", err)
+	}
+	if noise != nil {
+		var capacity int
+		for _, c := range process.Y4MFrameCapacity(loaded, chroma) {
+			capacity += c
+		}
+		data, err = process.FillWithNoise(data, capacity, noise)
+		if err != nil {
+			return err
+		}
+	}
+	err = process.EmbedMsgInY4M(data, loaded, chroma)
+	if err != nil {
+		return fmt.Errorf("error embedding message in file: %v", err)
+	}
+
+	err = y4m.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new Y4M file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package embedder
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/ziparchive"
+)
+
+const (
+	// ZipFieldExtra stores the message in the local file header extra fields
+	ZipFieldExtra = "extra"
+	// ZipFieldComment stores the message in the archive comment
+	ZipFieldComment = "comment"
+)
+
+// ProcessZip stores the message in a ZIP based archive's extra fields or comment, leaving
+// the archived files themselves untouched
+func ProcessZip(header, msg []byte, field string, dest io.Writer, src io.Reader) error {
+	loaded, err := ziparchive.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding ZIP file: %v", err)
+	}
+	container := process.FinalizeTrailer(header, msg)
+	switch field {
+	case "", ZipFieldExtra:
+		err = process.EmbedMsgInZipExtra(container, loaded)
+	case ZipFieldComment:
+		err = process.EmbedMsgInZipComment(container, loaded)
+	default:
+		return fmt.Errorf("unsupported zip field: %v", field)
+	}
+	if err != nil {
+		return fmt.Errorf("error embedding message in file: %v", err)
+	}
+
+	err = ziparchive.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new ZIP file: %v", err)
+	}
+	return nil
+}
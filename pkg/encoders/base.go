@@ -1,12 +1,16 @@
 package encoders
 
 import (
+	"encoding/base64"
 	"fmt"
+	mrand "math/rand/v2"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-// EncType enum for handling encoding types
+// EncType enum for handling encoding types. The values are written into the
+// message header, so an encoder's EncType must never change once released.
 type EncType int
 
 const (
@@ -22,49 +26,317 @@ const (
 	B85 EncType = iota
 	// GZIP compression
 	GZIP EncType = iota
+	// DEFLATE raw deflate compression
+	DEFLATE EncType = iota
+	// ZLIB zlib compression
+	ZLIB EncType = iota
+	// LZW compression
+	LZW EncType = iota
+	// B58 short for Base58 (Bitcoin alphabet) EncType
+	B58 EncType = iota
+	// B91 short for basE91 EncType
+	B91 EncType = iota
+	// Z85 short for ZeroMQ Base85 EncType
+	Z85 EncType = iota
+	// B64URL short for URL-safe, unpadded Base64 EncType
+	B64URL EncType = iota
+	// B32C short for Crockford Base32 EncType
+	B32C EncType = iota
+	// BASEN base-N with a user supplied alphabet
+	BASEN EncType = iota
+
+	// Auto picks whichever compression makes the message smallest when the pipeline
+	// is applied. It's never recorded in a header.
+	Auto EncType = -1
 )
 
-var encMap = map[int]string{
-	0: "r13",
-	1: "b16",
-	2: "b32",
-	3: "b64",
-	4: "b85",
-	5: "gzip",
-}
+// AutoName is what Auto is called on the command line
+const AutoName = "auto"
 
 func (e EncType) String() string {
 	return fmt.Sprintf("%d", e)
 }
 
+// Encoder is a single reversible step of a pre-encoding pipeline
+type Encoder interface {
+	// Name is what the encoder is called on the command line
+	Name() string
+	// ID is what the encoder is recorded as in the message header
+	ID() EncType
+	Encode(msg []byte) ([]byte, error)
+	Decode(msg []byte) ([]byte, error)
+}
+
+// Parameterized is implemented by encoders that need more than their ID to decode, such
+// as a custom alphabet. The parameter is recorded in the header after the ID, and given
+// on the command line after the name, separated by a colon: basen:0123456789abcdef
+type Parameterized interface {
+	Param() string
+}
+
+// Factory builds a parameterized encoder from its parameter
+type Factory func(param string) (Encoder, error)
+
+type factory struct {
+	name string
+	new  Factory
+}
+
+var (
+	registry  = map[EncType]Encoder{}
+	factories = map[EncType]factory{}
+)
+
+// Register makes an encoder available by name and ID. It panics when either is already
+// taken, since that would make existing headers ambiguous.
+func Register(e Encoder) {
+	mustBeFree(e.ID(), e.Name())
+	registry[e.ID()] = e
+}
+
+// RegisterFactory makes a parameterized encoder available by name and ID
+func RegisterFactory(id EncType, name string, f Factory) {
+	mustBeFree(id, name)
+	factories[id] = factory{name, f}
+}
+
+func mustBeFree(id EncType, name string) {
+	_, encoderID := registry[id]
+	_, factoryID := factories[id]
+	if encoderID || factoryID {
+		panic(fmt.Sprintf("encoders: ID %d registered twice", id))
+	}
+	_, nameTaken := ByName(name)
+	for _, f := range factories {
+		nameTaken = nameTaken || f.name == name
+	}
+	if nameTaken || name == AutoName {
+		panic(fmt.Sprintf("encoders: name %s registered twice", name))
+	}
+}
+
+// ByID returns the encoder recorded in a header as id
+func ByID(id EncType) (Encoder, bool) {
+	e, ok := registry[id]
+	return e, ok
+}
+
+// ByName returns the encoder called name on the command line
+func ByName(name string) (Encoder, bool) {
+	for _, e := range registry {
+		if e.Name() == name {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Names lists the registered encoder names in ID order, parameterized ones with a
+// placeholder for their parameter
+func Names() []string {
+	var ids []int
+	for id := range registry {
+		ids = append(ids, int(id))
+	}
+	for id := range factories {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		if e, ok := registry[EncType(id)]; ok {
+			names[i] = e.Name()
+		} else {
+			names[i] = factories[EncType(id)].name + ":<alphabet>"
+		}
+	}
+	return names
+}
+
+// codec adapts a pair of encode/decode functions to the Encoder interface
+type codec struct {
+	name     string
+	id       EncType
+	encode   func([]byte) ([]byte, error)
+	decode   func([]byte) ([]byte, error)
+	compress bool
+}
+
+func (c codec) Name() string                      { return c.name }
+func (c codec) ID() EncType                       { return c.id }
+func (c codec) Encode(msg []byte) ([]byte, error) { return c.encode(msg) }
+func (c codec) Decode(msg []byte) ([]byte, error) { return c.decode(msg) }
+func (c codec) Compresses() bool                  { return c.compress }
+
+// sizedCodec is a codec that knows how long its output is without encoding
+type sizedCodec struct {
+	codec
+	encodedLen func(n int) int
+}
+
+func (c sizedCodec) EncodedLen(n int) int { return c.encodedLen(n) }
+
+// IsCompression reports whether the encoder compresses, in which case its output must be
+// smaller than its input to be worth applying
+func IsCompression(e Encoder) bool {
+	c, ok := e.(interface{ Compresses() bool })
+	return ok && c.Compresses()
+}
+
+// infallible wraps an encode function that can't fail
+func infallible(f func([]byte) []byte) func([]byte) ([]byte, error) {
+	return func(msg []byte) ([]byte, error) {
+		return f(msg), nil
+	}
+}
+
+func init() {
+	Register(codec{"r13", R13, infallible(Rot13), infallible(Rot13), false})
+	Register(codec{"b16", B16, infallible(Encode16), Decode16, false})
+	Register(codec{"b32", B32, infallible(Encode32), Decode32, false})
+	Register(codec{"b64", B64, infallible(Encode64), Decode64, false})
+	Register(codec{"b85", B85, infallible(Encode85), Decode85, false})
+	Register(codec{"gzip", GZIP, Gzip, Gunzip, true})
+	Register(codec{"deflate", DEFLATE, Deflate, Inflate, true})
+	Register(codec{"zlib", ZLIB, Zlib, Unzlib, true})
+	Register(codec{"lzw", LZW, CompressLZW, DecompressLZW, true})
+	Register(sizedCodec{codec{"b58", B58, infallible(Encode58), Decode58, false}, base58.EncodedLen})
+	Register(codec{"b91", B91, infallible(Encode91), Decode91, false})
+	Register(codec{"z85", Z85, infallible(EncodeZ85), DecodeZ85, false})
+	Register(codec{"b64url", B64URL, infallible(Encode64URL), Decode64URL, false})
+	Register(codec{"b32c", B32C, infallible(Encode32Crockford), Decode32Crockford, false})
+	RegisterFactory(BASEN, "basen", NewBaseN)
+}
+
+// autoCandidates are the codecs Auto tries. Gzip is left out since its base64 output
+// never beats the raw codecs.
+var autoCandidates = []EncType{DEFLATE, ZLIB, LZW}
+
+// auto stands in for Auto in a pipeline until ApplyPreEncoding picks a codec
+type auto struct{}
+
+func (auto) Name() string { return AutoName }
+func (auto) ID() EncType  { return Auto }
+func (auto) Encode(msg []byte) ([]byte, error) {
+	compressed, _ := autoCompress(msg)
+	return compressed, nil
+}
+func (auto) Decode(msg []byte) ([]byte, error) {
+	return nil, fmt.Errorf("%s is resolved to a codec before it's recorded", AutoName)
+}
+
 // EncTypeFromString takes a string and returns an EncType
 func EncTypeFromString(s string) (EncType, error) {
-	for e, str := range encMap {
-		if s == str {
-			return EncType(e), nil
+	e, err := Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	return e.ID(), nil
+}
+
+// Parse returns the encoder for a name given on the command line, building parameterized
+// encoders from the parameter after the colon
+func Parse(s string) (Encoder, error) {
+	if s == AutoName {
+		return auto{}, nil
+	}
+	if e, ok := ByName(s); ok {
+		return e, nil
+	}
+	name, param, hasParam := strings.Cut(s, ":")
+	for _, f := range factories {
+		if f.name == name {
+			if !hasParam {
+				return nil, fmt.Errorf("%s needs a parameter, e.g. %s:0123456789abcdef", name, name)
+			}
+			return f.new(param)
 		}
 	}
-	return 0, fmt.Errorf("unknown encoding type: %v", s)
+	return nil, fmt.Errorf("unknown encoding type: %v", s)
 }
 
-func FromIntStrSlice(intStrSlice []string) ([]EncType, string) {
-	var out []EncType
+// HeaderCode returns how the encoder is recorded in the message header: its ID, followed
+// by its base64 encoded parameter for parameterized encoders
+func HeaderCode(e Encoder) string {
+	if p, ok := e.(Parameterized); ok {
+		return fmt.Sprintf("%d:%s", e.ID(), base64.RawURLEncoding.EncodeToString([]byte(p.Param())))
+	}
+	return e.ID().String()
+}
+
+// FromHeaderCodes parses the encoders recorded in a message header
+func FromHeaderCodes(codes []string) ([]Encoder, string) {
+	var out []Encoder
 	var errs []string
-	for i := range intStrSlice {
-		enc, err := strconv.Atoi(intStrSlice[i])
+	for _, code := range codes {
+		idStr, param, hasParam := strings.Cut(code, ":")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to parse encoding type %s: %v", code, err))
+			continue
+		}
+		if !hasParam {
+			e, ok := ByID(EncType(id))
+			if !ok {
+				errs = append(errs, fmt.Sprintf("unknown encoding type: %d", id))
+				continue
+			}
+			out = append(out, e)
+			continue
+		}
+		f, ok := factories[EncType(id)]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown encoding type: %d", id))
+			continue
+		}
+		rawParam, err := base64.RawURLEncoding.DecodeString(param)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("failed to parse encoding type %s: %v", intStrSlice[i], err))
+			errs = append(errs, fmt.Sprintf("failed to parse %s parameter: %v", f.name, err))
+			continue
 		}
-		out = append(out, EncType(enc))
+		e, err := f.new(string(rawParam))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		out = append(out, e)
 	}
 	return out, strings.Join(errs, "\n")
 }
 
-func FromStrSlice(encStrSlice []string) ([]EncType, string) {
-	var out []EncType
+// SplitNames splits each comma separated list of encoder names given on the command line.
+// A parameter, such as a base-N alphabet, can hold commas of its own, so a parameterized
+// encoder takes the rest of its list.
+func SplitNames(lists []string) []string {
+	var names []string
+	for _, list := range lists {
+		for list != "" {
+			name, rest, _ := strings.Cut(list, ",")
+			if factoryName, _, hasParam := strings.Cut(name, ":"); hasParam && isFactory(factoryName) {
+				names = append(names, list)
+				break
+			}
+			names, list = append(names, name), rest
+		}
+	}
+	return names
+}
+
+func isFactory(name string) bool {
+	for _, f := range factories {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FromStrSlice parses the encoder names given on the command line
+func FromStrSlice(encStrSlice []string) ([]Encoder, string) {
+	var out []Encoder
 	var errs []string
 	for i := range encStrSlice {
-		enc, err := EncTypeFromString(encStrSlice[i])
+		enc, err := Parse(encStrSlice[i])
 		if err != nil {
 			errs = append(errs, err.Error())
 		} else {
@@ -77,28 +349,140 @@ func FromStrSlice(encStrSlice []string) ([]EncType, string) {
 	return out, strings.Join(errs, "\n")
 }
 
-// ApplyPreEncoding encodes the message with each type of encoding passed through cli
-func ApplyPreEncoding(msg string, encs []EncType) ([]byte, error) {
-	for _, enc := range encs {
-		switch enc {
-		case R13:
-			msg = Rot13(msg)
-		case B16:
-			msg = Encode16(msg)
-		case B32:
-			msg = Encode32(msg)
-		case B64:
-			msg = Encode64(msg)
-		case B85:
-			msg = Encode85(msg)
-		case GZIP:
+// ValidatePipeline rejects pipelines whose steps undo or defeat each other:
+//   - r13 right after r13 embeds the message as plain text. auto steps in between don't
+//     count, since auto applies nothing when compression doesn't help.
+//   - Compressing more than once, auto included, only makes the message larger.
+//   - Compressing after a text encoding, such as b64, compresses worse than compressing
+//     first. r13 keeps the message as compressible as it was, so it can come before.
+func ValidatePipeline(encs []Encoder) error {
+	var afterR13, compressed bool
+	var textEncoding string
+	for _, e := range encs {
+		switch {
+		case e.ID() == R13:
+			if afterR13 {
+				return fmt.Errorf("r13 applied twice in a row leaves the message unencoded")
+			}
+			afterR13 = true
+			continue
+		case e.ID() == Auto || IsCompression(e):
+			if compressed {
+				return fmt.Errorf("%s compresses the message a second time, which only makes it larger", e.Name())
+			}
+			if textEncoding != "" {
+				return fmt.Errorf("%s compresses the %s encoded message, put the compression first", e.Name(), textEncoding)
+			}
+			compressed = true
+			if e.ID() == Auto {
+				continue
+			}
+		default:
+			textEncoding = e.Name()
+		}
+		afterR13 = false
+	}
+	return nil
+}
+
+// ApplyPreEncoding encodes the message with each type of encoding passed through cli,
+// returning the encoders actually applied: Auto is replaced by the codec it picked, or
+// dropped when no codec makes the message smaller. A compressor named explicitly that would
+// make the message larger fails instead, so the header always records the pipeline asked for.
+func ApplyPreEncoding(msg []byte, encs []Encoder) ([]byte, []Encoder, error) {
+	err := ValidatePipeline(encs)
+	if err != nil {
+		return nil, nil, err
+	}
+	var applied []Encoder
+	for _, e := range encs {
+		if e.ID() == Auto {
+			var best Encoder
+			msg, best = autoCompress(msg)
+			if best != nil {
+				applied = append(applied, best)
+			}
+			continue
+		}
+		encoded, err := e.Encode(msg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to apply %s: %v", e.Name(), err)
+		}
+		if IsCompression(e) && len(encoded) >= len(msg) {
+			return nil, nil, fmt.Errorf("%s would grow the message from %d to %d bytes, leave it out or use %s", e.Name(), len(msg), len(encoded), AutoName)
+		}
+		msg = encoded
+		applied = append(applied, e)
+	}
+	return msg, applied, nil
+}
+
+// MaxInputSize returns the largest message that still fits in limit bytes once encoded by
+// the pipeline. How much compression saves depends on the message, so compressing steps
+// are assumed to leave it as it is.
+func MaxInputSize(encs []Encoder, limit int) (int, error) {
+	fits := func(n int) (bool, error) {
+		// Random bytes are the worst case for encoders whose output size depends on the input
+		msg := make([]byte, n)
+		_, _ = mrand.NewChaCha8([32]byte{}).Read(msg)
+		for _, e := range encs {
+			if e.ID() == Auto || IsCompression(e) {
+				continue
+			}
+			if sized, ok := e.(interface{ EncodedLen(int) int }); ok {
+				// Stand in for the output, which is as good as random to the next step
+				msg = make([]byte, sized.EncodedLen(len(msg)))
+				_, _ = mrand.NewChaCha8([32]byte{1}).Read(msg)
+				continue
+			}
 			var err error
-			compMsg, err := Gzip([]byte(msg))
+			msg, err = e.Encode(msg)
 			if err != nil {
-				return nil, err
+				return false, fmt.Errorf("failed to apply %s: %v", e.Name(), err)
 			}
-			msg = string(compMsg)
+		}
+		return len(msg) <= limit, nil
+	}
+	low, high := 0, limit
+	for low < high {
+		mid := (low + high + 1) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low, nil
+}
+
+// autoCompress tries every candidate codec and keeps the smallest result, returning
+// a nil encoder and the message unchanged when none of them make it smaller
+func autoCompress(msg []byte) ([]byte, Encoder) {
+	best := msg
+	var bestEncoder Encoder
+	for _, enc := range autoCandidates {
+		e, _ := ByID(enc)
+		compressed, err := e.Encode(msg)
+		if err == nil && len(compressed) < len(best) {
+			best, bestEncoder = compressed, e
+		}
+	}
+	return best, bestEncoder
+}
+
+// RemovePreEncoding undoes ApplyPreEncoding, decoding in the reverse order the
+// encoders were applied
+func RemovePreEncoding(msg []byte, encs []Encoder) ([]byte, error) {
+	var err error
+	for i := len(encs) - 1; i >= 0; i-- {
+		msg, err = encs[i].Decode(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s message: %v", encs[i].Name(), err)
 		}
 	}
-	return []byte(msg), nil
+	return msg, nil
 }
@@ -2,20 +2,27 @@ package encoders
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
 	"encoding/ascii85"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"slices"
 	"strings"
 )
 
 // ==============================
 // Rot13 Encoder/Decoder funcs
 // ==============================
-func rot13(x rune) rune {
+func rot13(x byte) byte {
 	capital := x >= 'A' && x <= 'Z'
 	if !capital && (x < 'a' || x > 'z') {
 		return x // Not a letter
@@ -27,9 +34,14 @@ func rot13(x rune) rune {
 	return x
 }
 
-// Rot13 Encode and Decode are the same thing
-func Rot13(input string) string {
-	return strings.Map(rot13, input)
+// Rot13 Encode and Decode are the same thing. It works byte by byte so
+// non-UTF-8 input passes through untouched.
+func Rot13(input []byte) []byte {
+	out := make([]byte, len(input))
+	for i, b := range input {
+		out[i] = rot13(b)
+	}
+	return out
 }
 
 // ==============================
@@ -37,91 +49,93 @@ func Rot13(input string) string {
 // ==============================
 
 // Encode16 takes a message and hex encodes it
-func Encode16(msg string) string {
-	b := []byte(msg)
-	encoded := make([]byte, hex.EncodedLen(len(b)))
-	_ = hex.Encode(encoded, b)
-	return string(encoded)
+func Encode16(msg []byte) []byte {
+	encoded := make([]byte, hex.EncodedLen(len(msg)))
+	_ = hex.Encode(encoded, msg)
+	return encoded
 }
 
-// Decode16 takes an encoded hex string and decodes it
-func Decode16(src string) (string, error) {
-	b := []byte(src)
-	decoded := make([]byte, len(b))
-	_, err := hex.Decode(decoded, b)
+// Decode16 takes hex encoded data and decodes it
+func Decode16(src []byte) ([]byte, error) {
+	decoded := make([]byte, hex.DecodedLen(len(src)))
+	_, err := hex.Decode(decoded, src)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(decoded), nil
+	return decoded, nil
 }
 
 // ==============================
 // Base32 Encoder/Decoder funcs
 // ==============================
 
-// Encode32 takes in a message string and applies Base32 encoding
-func Encode32(msg string) string {
-	return base32.StdEncoding.EncodeToString([]byte(msg))
+// Encode32 takes in a message and applies Base32 encoding
+func Encode32(msg []byte) []byte {
+	encoded := make([]byte, base32.StdEncoding.EncodedLen(len(msg)))
+	base32.StdEncoding.Encode(encoded, msg)
+	return encoded
 }
 
-// Decode32 takes an encoded Base32 string and decodes it
-func Decode32(src string) (string, error) {
-	decoded, err := base32.StdEncoding.DecodeString(src)
+// Decode32 takes Base32 encoded data and decodes it
+func Decode32(src []byte) ([]byte, error) {
+	decoded := make([]byte, base32.StdEncoding.DecodedLen(len(src)))
+	n, err := base32.StdEncoding.Decode(decoded, src)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(decoded), nil
+	return decoded[:n], nil
 }
 
 // ==============================
 // Base64 Encoder/Decoder funcs
 // ==============================
 
-// Encode64 takes in a message string and Base64 encodes it
-func Encode64(msg string) string {
-	return base64.StdEncoding.EncodeToString([]byte(msg))
+// Encode64 takes in a message and Base64 encodes it
+func Encode64(msg []byte) []byte {
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(msg)))
+	base64.StdEncoding.Encode(encoded, msg)
+	return encoded
 }
 
-// Decode64 takes an encoded Base64 string and decodes it
-func Decode64(src string) (string, error) {
-	decoded, err := base64.StdEncoding.DecodeString(src)
+// Decode64 takes Base64 encoded data and decodes it
+func Decode64(src []byte) ([]byte, error) {
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(src)))
+	n, err := base64.StdEncoding.Decode(decoded, src)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(decoded), nil
+	return decoded[:n], nil
 }
 
 // ==============================
 // Base85 Encoder/Decoder funcs
 // ==============================
 
-// Encode85 takes in a message string and Base85 encodes it
-func Encode85(msg string) string {
-	b := []byte(msg)
-	encoded := make([]byte, ascii85.MaxEncodedLen(len(b)))
-	_ = ascii85.Encode(encoded, b)
-	return string(encoded)
+// Encode85 takes in a message and Base85 encodes it
+func Encode85(msg []byte) []byte {
+	encoded := make([]byte, ascii85.MaxEncodedLen(len(msg)))
+	n := ascii85.Encode(encoded, msg)
+	return encoded[:n]
 }
 
-// Decode85 takes an encoded Base85 string and decodes it
-func Decode85(src string) (string, error) {
-	b := []byte(src)
-	decoded := make([]byte, len(b))
-	numBytes, _, err := ascii85.Decode(decoded, b, true)
+// Decode85 takes Base85 encoded data and decodes it
+func Decode85(src []byte) ([]byte, error) {
+	// Earlier versions embedded the unused tail of the encode buffer as null bytes
+	src = bytes.TrimRight(src, "\x00")
+	// A z stands for four zero bytes, and the final group is decoded four bytes at a time
+	decoded := make([]byte, 4*len(src)+4)
+	numBytes, _, err := ascii85.Decode(decoded, src, true)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	decoded = decoded[:numBytes]
-	// remove /x00 null bytes before returning
-	decoded = bytes.Trim(decoded, "\x00")
-	return string(decoded), nil
+	return decoded[:numBytes], nil
 }
 
 // ==============================
 // Gzip Compress/Decompress funcs
 // ==============================
 
-// Gzip takes in a message string and Gzip compresses it, and then Base64 encodes it
+// Gzip takes in a message and Gzip compresses it, and then Base64 encodes it
 // for embedding
 func Gzip(msg []byte) ([]byte, error) {
 	var buf bytes.Buffer
@@ -137,20 +151,411 @@ func Gzip(msg []byte) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to close gzip writer: %v", err)
 	}
-	out := Encode64(buf.String())
-	return []byte(out), nil
+	return Encode64(buf.Bytes()), nil
 }
 
 // Gunzip takes in a Gzip compressed byte slice, Base64 decodes it and decompresses it
 func Gunzip(data []byte) ([]byte, error) {
-	bs, err := Decode64(string(data))
+	bs, err := Decode64(data)
 	if err != nil {
 		return nil, err
 	}
-	reader, err := gzip.NewReader(strings.NewReader(bs))
+	reader, err := gzip.NewReader(bytes.NewReader(bs))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gzip reader: %v", err)
 	}
 	defer reader.Close()
-	return io.ReadAll(reader)
+	return decompress(reader)
+}
+
+// ==============================
+// Raw Compress/Decompress funcs
+// ==============================
+//
+// The LSB channel is binary safe, so unlike Gzip these leave their output as raw bytes
+
+// Deflate compresses the message into a raw DEFLATE stream
+func Deflate(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deflate writer: %v", err)
+	}
+	return compress(&buf, writer, msg)
+}
+
+// Inflate decompresses a raw DEFLATE stream
+func Inflate(data []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+	return decompress(reader)
+}
+
+// Zlib compresses the message into a zlib stream
+func Zlib(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zlib writer: %v", err)
+	}
+	return compress(&buf, writer, msg)
+}
+
+// Unzlib decompresses a zlib stream
+func Unzlib(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zlib reader: %v", err)
+	}
+	defer reader.Close()
+	return decompress(reader)
+}
+
+// CompressLZW compresses the message with 8 bit LSB first LZW, as used by GIF
+func CompressLZW(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	return compress(&buf, lzw.NewWriter(&buf, lzw.LSB, 8), msg)
+}
+
+// DecompressLZW decompresses an LZW stream written by CompressLZW
+func DecompressLZW(data []byte) ([]byte, error) {
+	reader := lzw.NewReader(bytes.NewReader(data), lzw.LSB, 8)
+	defer reader.Close()
+	return decompress(reader)
+}
+
+// MaxDecompressedSize is the most a compressed message is allowed to expand to, so a
+// crafted carrier can't exhaust memory on extract
+const MaxDecompressedSize = 1 << 30
+
+// decompress reads the whole decompressed stream, failing once it passes MaxDecompressedSize
+func decompress(reader io.Reader) ([]byte, error) {
+	msg, err := io.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) > MaxDecompressedSize {
+		return nil, fmt.Errorf("message decompresses to more than %d bytes", MaxDecompressedSize)
+	}
+	return msg, nil
+}
+
+func compress(buf *bytes.Buffer, writer io.WriteCloser, msg []byte) ([]byte, error) {
+	_, err := writer.Write(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress: %v", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ==============================
+// Base-N Encoder/Decoder funcs
+// ==============================
+
+const (
+	alphabet58        = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	alphabet91        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,./:;<=>?@[]^_`{|}~\""
+	alphabetZ85       = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+	alphabetCrockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var (
+	base58 = mustBaseN(alphabet58)
+	// Crockford Base32 is unpadded and case insensitive, reading I and L as 1 and O as 0
+	crockford         = base32.NewEncoding(alphabetCrockford).WithPadding(base32.NoPadding)
+	crockfordReplacer = strings.NewReplacer("I", "1", "L", "1", "O", "0", "-", "")
+)
+
+// BaseN converts messages to and from a positional numeral system with an arbitrary
+// alphabet, treating the message as one big-endian number. Leading zero bytes are kept
+// as leading copies of the alphabet's first character, as in Base58.
+type BaseN struct {
+	alphabet string
+	index    [256]int
+	// chunk is the largest power of the base that fits in a word, and digits its exponent,
+	// so the conversion can work a word at a time
+	chunk  *big.Int
+	digits int
+}
+
+// NewBaseN returns a base-N encoder for the alphabet, which must hold between 2 and 256
+// distinct bytes
+func NewBaseN(alphabet string) (Encoder, error) {
+	return newBaseN(alphabet)
+}
+
+func newBaseN(alphabet string) (*BaseN, error) {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return nil, fmt.Errorf("alphabet must hold between 2 and 256 characters, got %d", len(alphabet))
+	}
+	b := &BaseN{alphabet: alphabet}
+	for i := range b.index {
+		b.index[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		if b.index[alphabet[i]] >= 0 {
+			return nil, fmt.Errorf("alphabet repeats the character %q", alphabet[i])
+		}
+		b.index[alphabet[i]] = i
+	}
+	base := uint64(len(alphabet))
+	chunk := base
+	b.digits = 1
+	for chunk <= (1<<63)/base {
+		chunk *= base
+		b.digits++
+	}
+	b.chunk = new(big.Int).SetUint64(chunk)
+	return b, nil
+}
+
+func mustBaseN(alphabet string) *BaseN {
+	b, err := newBaseN(alphabet)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (b *BaseN) Name() string  { return "basen" }
+func (b *BaseN) ID() EncType   { return BASEN }
+func (b *BaseN) Param() string { return b.alphabet }
+
+// EncodedLen returns the length of the longest encoding of an n byte message, saving
+// capacity checks from converting large messages
+func (b *BaseN) EncodedLen(n int) int {
+	return int(math.Ceil(float64(n) * 8 / math.Log2(float64(len(b.alphabet)))))
+}
+
+// Encode converts the message to the alphabet
+func (b *BaseN) Encode(msg []byte) ([]byte, error) {
+	zeros := 0
+	for zeros < len(msg) && msg[zeros] == 0 {
+		zeros++
+	}
+	base := uint64(len(b.alphabet))
+	n := new(big.Int).SetBytes(msg[zeros:])
+	rem := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.QuoRem(n, b.chunk, rem)
+		r := rem.Uint64()
+		for i := 0; i < b.digits && (n.Sign() > 0 || r > 0); i++ {
+			out = append(out, b.alphabet[r%base])
+			r /= base
+		}
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, b.alphabet[0])
+	}
+	slices.Reverse(out)
+	return out, nil
+}
+
+// Decode converts text in the alphabet back to the message
+func (b *BaseN) Decode(src []byte) ([]byte, error) {
+	zeros := 0
+	for zeros < len(src) && src[zeros] == b.alphabet[0] {
+		zeros++
+	}
+	base := uint64(len(b.alphabet))
+	n := new(big.Int)
+	word := new(big.Int)
+	for start := zeros; start < len(src); start += b.digits {
+		end := min(start+b.digits, len(src))
+		var value, scale uint64 = 0, 1
+		for _, c := range src[start:end] {
+			digit := b.index[c]
+			if digit < 0 {
+				return nil, fmt.Errorf("invalid character %q", c)
+			}
+			value = value*base + uint64(digit)
+			scale *= base
+		}
+		n.Mul(n, word.SetUint64(scale))
+		n.Add(n, word.SetUint64(value))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// Encode58 takes in a message and Base58 encodes it with the Bitcoin alphabet
+func Encode58(msg []byte) []byte {
+	encoded, _ := base58.Encode(msg)
+	return encoded
+}
+
+// Decode58 takes Base58 encoded data and decodes it
+func Decode58(src []byte) ([]byte, error) {
+	return base58.Decode(src)
+}
+
+// ==============================
+// Base91 Encoder/Decoder funcs
+// ==============================
+
+// Encode91 takes in a message and basE91 encodes it
+func Encode91(msg []byte) []byte {
+	var out []byte
+	var queue, bits uint
+	for _, c := range msg {
+		queue |= uint(c) << bits
+		bits += 8
+		if bits > 13 {
+			value := queue & 8191
+			if value > 88 {
+				queue >>= 13
+				bits -= 13
+			} else {
+				value = queue & 16383
+				queue >>= 14
+				bits -= 14
+			}
+			out = append(out, alphabet91[value%91], alphabet91[value/91])
+		}
+	}
+	if bits > 0 {
+		out = append(out, alphabet91[queue%91])
+		if bits > 7 || queue > 90 {
+			out = append(out, alphabet91[queue/91])
+		}
+	}
+	return out
+}
+
+// Decode91 takes basE91 encoded data and decodes it
+func Decode91(src []byte) ([]byte, error) {
+	var out []byte
+	var queue, bits uint
+	value := -1
+	for _, c := range src {
+		digit := strings.IndexByte(alphabet91, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q", c)
+		}
+		if value < 0 {
+			value = digit
+			continue
+		}
+		value += digit * 91
+		queue |= uint(value) << bits
+		if value&8191 > 88 {
+			bits += 13
+		} else {
+			bits += 14
+		}
+		for bits > 7 {
+			out = append(out, byte(queue))
+			queue >>= 8
+			bits -= 8
+		}
+		value = -1
+	}
+	if value >= 0 {
+		out = append(out, byte(queue|uint(value)<<bits))
+	}
+	return out, nil
+}
+
+// ==============================
+// Z85 Encoder/Decoder funcs
+// ==============================
+
+// EncodeZ85 takes in a message and Z85 encodes it. Z85 itself only covers messages
+// whose length is a multiple of 4, so a shorter final group is written like Ascii85
+// does it: padded with zeros and cut down to one character more than its length.
+func EncodeZ85(msg []byte) []byte {
+	var out []byte
+	for i := 0; i < len(msg); i += 4 {
+		var group [4]byte
+		n := copy(group[:], msg[i:])
+		value := binary.BigEndian.Uint32(group[:])
+		var chars [5]byte
+		for j := 4; j >= 0; j-- {
+			chars[j] = alphabetZ85[value%85]
+			value /= 85
+		}
+		out = append(out, chars[:n+1]...)
+	}
+	return out
+}
+
+// DecodeZ85 takes Z85 encoded data and decodes it
+func DecodeZ85(src []byte) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(src); i += 5 {
+		n := min(5, len(src)-i)
+		if n == 1 {
+			return nil, fmt.Errorf("truncated final group")
+		}
+		var value uint64
+		for j := 0; j < 5; j++ {
+			digit := 84
+			if j < n {
+				digit = strings.IndexByte(alphabetZ85, src[i+j])
+				if digit < 0 {
+					return nil, fmt.Errorf("invalid character %q", src[i+j])
+				}
+			}
+			value = value*85 + uint64(digit)
+		}
+		if value > 0xFFFFFFFF {
+			if n == 5 {
+				return nil, fmt.Errorf("group %q is out of range", src[i:i+5])
+			}
+			// The final group was padded past its largest value, drop the carry
+			value = 0xFFFFFFFF
+		}
+		group := binary.BigEndian.AppendUint32(nil, uint32(value))
+		out = append(out, group[:n-1]...)
+	}
+	return out, nil
+}
+
+// ==============================
+// URL-safe Base64 Encoder/Decoder funcs
+// ==============================
+
+// Encode64URL takes in a message and Base64 encodes it with the URL-safe alphabet and
+// no padding
+func Encode64URL(msg []byte) []byte {
+	encoded := make([]byte, base64.RawURLEncoding.EncodedLen(len(msg)))
+	base64.RawURLEncoding.Encode(encoded, msg)
+	return encoded
+}
+
+// Decode64URL takes URL-safe, unpadded Base64 encoded data and decodes it
+func Decode64URL(src []byte) ([]byte, error) {
+	decoded := make([]byte, base64.RawURLEncoding.DecodedLen(len(src)))
+	n, err := base64.RawURLEncoding.Decode(decoded, src)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:n], nil
+}
+
+// ==============================
+// Crockford Base32 Encoder/Decoder funcs
+// ==============================
+
+// Encode32Crockford takes in a message and Base32 encodes it with Crockford's alphabet
+func Encode32Crockford(msg []byte) []byte {
+	encoded := make([]byte, crockford.EncodedLen(len(msg)))
+	crockford.Encode(encoded, msg)
+	return encoded
+}
+
+// Decode32Crockford takes Crockford Base32 encoded data and decodes it, ignoring case
+// and hyphens
+func Decode32Crockford(src []byte) ([]byte, error) {
+	normalized := []byte(crockfordReplacer.Replace(strings.ToUpper(string(src))))
+	decoded := make([]byte, crockford.DecodedLen(len(normalized)))
+	n, err := crockford.Decode(decoded, normalized)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:n], nil
 }
@@ -0,0 +1,232 @@
+package encoders
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// blobs returns random binary messages, including the empty message, leading zero bytes
+// and runs that compressors can shrink
+func blobs(t *testing.T) map[string][]byte {
+	t.Helper()
+	r := rand.New(rand.NewPCG(1, 2))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(r.UintN(256))
+		}
+		return b
+	}
+	var runs []byte
+	for len(runs) < 4096 {
+		runs = append(runs, bytes.Repeat([]byte{byte(r.UintN(256))}, 1+r.IntN(16))...)
+	}
+	return map[string][]byte{
+		"empty":         {},
+		"single":        {0xff},
+		"leading zeros": append([]byte{0, 0, 0}, random(61)...),
+		"all zeros":     make([]byte, 32),
+		"random":        random(1024),
+		"runs":          runs,
+	}
+}
+
+// pipelines returns every registered encoder on its own, parameterized ones with a few
+// alphabets, under the name it's given on the command line
+func pipelines(t *testing.T) map[string][]Encoder {
+	t.Helper()
+	names := []string{AutoName, "basen:01", "basen:ACGT", "basen:0123456789", "basen:!#$%&()*+,-./:;<=>?@[]^_`{|}~"}
+	for _, name := range Names() {
+		if !strings.Contains(name, ":") {
+			names = append(names, name)
+		}
+	}
+	out := make(map[string][]Encoder, len(names))
+	for _, name := range names {
+		e, err := Parse(name)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", name, err)
+		}
+		out[name] = []Encoder{e}
+	}
+	return out
+}
+
+// grows reports whether e is a compressor that would make blob larger, which
+// ApplyPreEncoding refuses to run
+func grows(e Encoder, blob []byte) bool {
+	if !IsCompression(e) {
+		return false
+	}
+	encoded, err := e.Encode(blob)
+	return err == nil && len(encoded) >= len(blob)
+}
+
+func TestEncodersRoundTrip(t *testing.T) {
+	for name, encs := range pipelines(t) {
+		for blobName, blob := range blobs(t) {
+			encoded, applied, err := ApplyPreEncoding(bytes.Clone(blob), encs)
+			if grows(encs[0], blob) {
+				if err == nil {
+					t.Errorf("%s, %s: compressing made the message larger but didn't fail", name, blobName)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s, %s: encode: %v", name, blobName, err)
+				continue
+			}
+			decoded, err := RemovePreEncoding(encoded, applied)
+			if err != nil {
+				t.Errorf("%s, %s: decode: %v", name, blobName, err)
+				continue
+			}
+			if !bytes.Equal(decoded, blob) {
+				t.Errorf("%s, %s: round trip changed the message", name, blobName)
+			}
+		}
+	}
+}
+
+func TestOnlyAutoSkipsCompression(t *testing.T) {
+	blob := blobs(t)["random"]
+	deflate, _ := Parse("deflate")
+	b64, _ := Parse("b64")
+	if _, _, err := ApplyPreEncoding(bytes.Clone(blob), []Encoder{deflate, b64}); err == nil {
+		t.Error("deflate made random data larger without failing")
+	}
+	auto, _ := Parse(AutoName)
+	_, applied, err := ApplyPreEncoding(bytes.Clone(blob), []Encoder{auto, b64})
+	if err != nil {
+		t.Fatalf("auto: %v", err)
+	}
+	if len(applied) != 1 || applied[0].ID() != B64 {
+		t.Errorf("auto on random data applied %d encoders, want b64 alone", len(applied))
+	}
+}
+
+func TestHeaderCodesRoundTrip(t *testing.T) {
+	for name, encs := range pipelines(t) {
+		if encs[0].ID() == Auto {
+			continue
+		}
+		parsed, warnings := FromHeaderCodes([]string{HeaderCode(encs[0])})
+		if warnings != "" || len(parsed) != 1 {
+			t.Errorf("%s: header code %q doesn't parse back: %s", name, HeaderCode(encs[0]), warnings)
+			continue
+		}
+		blob := blobs(t)["random"]
+		encoded, err := encs[0].Encode(blob)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", name, err)
+		}
+		decoded, err := parsed[0].Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, blob) {
+			t.Errorf("%s: encoder parsed from the header doesn't decode the message: %v", name, err)
+		}
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	blob := blobs(t)["random"]
+	for _, alphabet := range []string{"01", "ACGT", alphabet58, alphabet91} {
+		b := mustBaseN(alphabet)
+		for n := 0; n <= len(blob); n += 37 {
+			encoded, _ := b.Encode(blob[:n])
+			if len(encoded) > b.EncodedLen(n) {
+				t.Errorf("base %d: %d bytes encode to %d characters, over EncodedLen %d", len(alphabet), n, len(encoded), b.EncodedLen(n))
+			}
+		}
+	}
+}
+
+func TestSplitNames(t *testing.T) {
+	tests := []struct {
+		lists []string
+		want  []string
+	}{
+		{[]string{"gzip,b64"}, []string{"gzip", "b64"}},
+		{[]string{"gzip", "b64,r13"}, []string{"gzip", "b64", "r13"}},
+		{[]string{"gzip,basen:a,b;c"}, []string{"gzip", "basen:a,b;c"}},
+		{[]string{"basen:,.", "b64"}, []string{"basen:,.", "b64"}},
+		{[]string{"zlib,basen:!#$%&()*+,-./:;<=>?@[]^_`{|}~"}, []string{"zlib", "basen:!#$%&()*+,-./:;<=>?@[]^_`{|}~"}},
+	}
+	for _, test := range tests {
+		if got := SplitNames(test.lists); !slices.Equal(got, test.want) {
+			t.Errorf("SplitNames(%q) = %q, want %q", test.lists, got, test.want)
+		}
+	}
+}
+
+func TestBaseNPunctuationRoundTrip(t *testing.T) {
+	for _, list := range []string{"basen:,.", "gzip,basen:,;:!?", "basen:!#$%&()*+,-./:;<=>?@[]^_`{|}~"} {
+		encs, warnings := FromStrSlice(SplitNames([]string{list}))
+		if warnings != "" {
+			t.Fatalf("%s: %s", list, warnings)
+		}
+		for blobName, blob := range blobs(t) {
+			if grows(encs[0], blob) {
+				continue
+			}
+			encoded, applied, err := ApplyPreEncoding(bytes.Clone(blob), encs)
+			if err != nil {
+				t.Errorf("%s, %s: encode: %v", list, blobName, err)
+				continue
+			}
+			var codes []string
+			for _, e := range applied {
+				codes = append(codes, HeaderCode(e))
+			}
+			decoders, warnings := FromHeaderCodes(codes)
+			if warnings != "" {
+				t.Errorf("%s, %s: %s", list, blobName, warnings)
+				continue
+			}
+			decoded, err := RemovePreEncoding(encoded, decoders)
+			if err != nil {
+				t.Errorf("%s, %s: decode: %v", list, blobName, err)
+				continue
+			}
+			if !bytes.Equal(decoded, blob) {
+				t.Errorf("%s, %s: round trip changed the message", list, blobName)
+			}
+		}
+	}
+}
+
+func TestValidatePipeline(t *testing.T) {
+	tests := []struct {
+		pipeline string
+		valid    bool
+	}{
+		{"r13", true},
+		{"gzip,b64", true},
+		{"deflate,b58,r13", true},
+		{"r13,zlib,b64", true},
+		{"r13,gzip,r13", true},
+		{"auto,basen:ACGT", true},
+		{"b64,r13,b32", true},
+		{"r13,r13", false},
+		{"r13,auto,r13", false},
+		{"b64,r13,r13", false},
+		{"gzip,deflate", false},
+		{"auto,lzw", false},
+		{"zlib,b64,auto", false},
+		{"b64,gzip", false},
+		{"b91,deflate", false},
+		{"b16,r13,auto", false},
+	}
+	for _, test := range tests {
+		encs, warnings := FromStrSlice(SplitNames([]string{test.pipeline}))
+		if warnings != "" {
+			t.Fatalf("%s: %s", test.pipeline, warnings)
+		}
+		err := ValidatePipeline(encs)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidatePipeline(%s) = %v, want valid=%v", test.pipeline, err, test.valid)
+		}
+	}
+}
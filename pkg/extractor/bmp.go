@@ -9,14 +9,14 @@ import (
 	"golang.org/x/image/bmp"
 )
 
-func ProcessBMP(src io.Reader) (string, error) {
+func ProcessBMP(src io.Reader) (*process.Header, []byte, error) {
 	loadedImage, err := bmp.Decode(src)
 	if err != nil {
-		return "", fmt.Errorf("error decoding BMP file: %v", err)
+		return nil, nil, fmt.Errorf("error decoding BMP file: %v", err)
 	}
 	header, extracted, err := process.ExtractMsgFromImage(loadedImage)
 	if err != nil {
-		return "", fmt.Errorf("error extracting from image: %v", err)
+		return nil, nil, fmt.Errorf("error extracting from image: %v", err)
 	}
-	return DecodeMessage(header, extracted)
+	return header, extracted, nil
 }
@@ -1,104 +1,290 @@
 package extractor
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"image"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/bshore/steggo/pkg/encoders"
 	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/tarball"
+	"github.com/bshore/steggo/pkg/utils"
 )
 
 type Config struct {
 	Target          io.ReadSeeker
 	DestinationPath string
+	// Name overrides the file name the message is written to in DestinationPath
+	Name string
+	// List prints what was embedded instead of writing it out
+	List bool
+	// Output is a file to write the message to as-is, - writes it to stdout
+	Output string
+	// Targets are the carriers of a message split into shards, used instead of Target
+	Targets []io.ReadSeeker
+	// Passphrase extracts the layer embedded under it instead of the plain message
+	Passphrase string
+	// IgnoreExpiry extracts messages past their expiry time instead of refusing them
+	IgnoreExpiry bool
+	// Force replaces files that already exist in DestinationPath instead of refusing to
+	Force bool
 }
 
 func Process(config *Config) error {
+	targets := config.Targets
+	if len(targets) == 0 {
+		targets = []io.ReadSeeker{config.Target}
+	}
+	var headers []*process.Header
+	var pieces [][]byte
+	for i, target := range targets {
+		header, extracted, err := Extract(target, config.Passphrase)
+		if err != nil {
+			if len(targets) > 1 {
+				return fmt.Errorf("target %d: %v", i+1, err)
+			}
+			return err
+		}
+		headers = append(headers, header)
+		pieces = append(pieces, extracted)
+	}
+
+	header, extracted := headers[0], pieces[0]
+	if header.Shard != nil {
+		var err error
+		header, extracted, err = process.JoinShards(headers, pieces)
+		if err != nil {
+			return fmt.Errorf("failed to join shards: %v", err)
+		}
+	} else if len(targets) > 1 {
+		return fmt.Errorf("target 1 holds a whole message, only shards can be extracted from several targets")
+	}
+	if header.Meta.Expired(time.Now()) {
+		expires := header.Meta.Expires.Format(time.RFC3339)
+		if !config.IgnoreExpiry {
+			return fmt.Errorf("message expired on %s, use --ignore-expiry to extract it anyway", expires)
+		}
+		fmt.Fprintf(os.Stderr, "warning: message expired on %s\n", expires)
+	}
+	printMetadata(header.Meta)
+	message, err := DecodeMessage(header, extracted)
+	if err != nil {
+		return err
+	}
+	return writeMessage(header, message, config)
+}
+
+// Extract extracts the header and the still pre-encoded message from one target, reading
+// the layer embedded under the passphrase when one is given
+func Extract(target io.ReadSeeker, passphrase string) (*process.Header, []byte, error) {
 	var err error
-	var message string
-	_, format, err := image.Decode(config.Target)
+	var header *process.Header
+	var extracted []byte
+	format, err := utils.DetectFormat(target)
 	if err != nil {
-		return fmt.Errorf("failed to decode target file: %v", err)
+		return nil, nil, err
+	}
+
+	contents, err := io.ReadAll(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read target file: %v", err)
+	}
+	_, _ = target.Seek(0, 0)
+
+	if passphrase != "" {
+		header, extracted, err = ProcessLayer(bytes.NewReader(contents), passphrase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to process layer: %v", err)
+		}
+		return header, extracted, nil
+	}
+
+	// A message appended after the carrier's logical end takes precedence over LSB extraction
+	if trailerHeader, trailerMsg, trailerErr := process.ExtractMsgFromTrailer(contents, format); trailerErr == nil {
+		return trailerHeader, trailerMsg, nil
 	}
-	_, _ = config.Target.Seek(0, 0)
 
 	switch format {
 	case "png":
-		message, err = ProcessPNG(config.Target)
+		header, extracted, err = ProcessPNG(bytes.NewReader(contents))
 		if err != nil {
-			return fmt.Errorf("failed to process PNG: %v", err)
+			return nil, nil, fmt.Errorf("failed to process PNG: %v", err)
 		}
 	case "bmp":
-		message, err = ProcessBMP(config.Target)
+		header, extracted, err = ProcessBMP(bytes.NewReader(contents))
 		if err != nil {
-			return fmt.Errorf("failed to process BMP: %v", err)
+			return nil, nil, fmt.Errorf("failed to process BMP: %v", err)
 		}
 	case "gif":
-		message, err = ProcessGif(config.Target)
+		header, extracted, err = ProcessGif(bytes.NewReader(contents))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to process GIF: %v", err)
+		}
+	case "ico", "cur":
+		header, extracted, err = ProcessICO(bytes.NewReader(contents))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to process ICO: %v", err)
+		}
+	case "y4m":
+		header, extracted, err = ProcessY4M(bytes.NewReader(contents))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to process Y4M: %v", err)
+		}
+	case "zip":
+		header, extracted, err = ProcessZip(bytes.NewReader(contents))
 		if err != nil {
-			return fmt.Errorf("failed to process GIF: %v", err)
+			return nil, nil, fmt.Errorf("failed to process ZIP: %v", err)
+		}
+	case "mid":
+		header, extracted, err = ProcessMIDI(bytes.NewReader(contents))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to process MIDI: %v", err)
 		}
 	default:
-		return fmt.Errorf("unsupported source file format: %v", format)
-	}
-	if config.DestinationPath != "" {
-		return os.WriteFile(filepath.Join(config.DestinationPath, "message.txt"), []byte(message), 0644)
+		return nil, nil, fmt.Errorf("unsupported source file format: %v", format)
 	}
-	fmt.Fprintln(os.Stdout, message)
+	return header, extracted, nil
+}
 
+// writeMessage writes the message into the destination path if one was supplied,
+// otherwise it prints it to stdout. The file is named after the embedded input file
+// unless a name was given, falling back to message.txt for text input. An embedded
+// tar archive is unpacked into the destination path instead. Existing files are left
+// alone unless config.Force is set.
+func writeMessage(header *process.Header, message []byte, config *Config) error {
+	if config.List {
+		return listMessage(header, message)
+	}
+	if config.Output == utils.Stdio {
+		_, err := os.Stdout.Write(message)
+		return err
+	}
+	if config.Output != "" {
+		err := os.WriteFile(config.Output, message, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write message: %v", err)
+		}
+		return nil
+	}
+	if isPacked(header) && config.DestinationPath != "" && config.Name == "" {
+		written, err := tarball.Unpack(message, config.DestinationPath, config.Force)
+		for _, path := range written {
+			fmt.Fprintf(os.Stderr, "extracted %s\n", path)
+		}
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%v, use --force to replace it or another --dest", err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unpack message: %v", err)
+		}
+		return nil
+	}
+	if config.DestinationPath == "" {
+		_, err := os.Stdout.Write(message)
+		return err
+	}
+	name := config.Name
+	if name == "" && header.Name != "" {
+		name = header.Name + header.SrcType
+	}
+	name = utils.SafeFilename(name)
+	if name == "" {
+		name = "message.txt"
+	}
+	mode := header.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	path := filepath.Join(config.DestinationPath, name)
+	// The name comes from the carrier, so an existing file is only replaced when asked to,
+	// and then keeps its own permissions
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if config.Force {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, mode)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to replace it or --name to pick another name", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+	_, err = f.Write(message)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "extracted message to %s\n", path)
 	return nil
 }
 
-func DecodeMessage(header *process.Header, extracted []byte) (string, error) {
-	msg := string(extracted)
-	var err error
+// printMetadata prints the metadata fields that were embedded with the message to stderr,
+// keeping stdout for the message itself
+func printMetadata(meta process.Metadata) {
+	if !meta.Created.IsZero() {
+		fmt.Fprintf(os.Stderr, "created: %s\n", meta.Created.Format(time.RFC3339))
+	}
+	if !meta.Expires.IsZero() {
+		fmt.Fprintf(os.Stderr, "expires: %s\n", meta.Expires.Format(time.RFC3339))
+	}
+	if meta.Sender != "" {
+		fmt.Fprintf(os.Stderr, "sender: %s\n", meta.Sender)
+	}
+	if meta.ContentType != "" {
+		fmt.Fprintf(os.Stderr, "content-type: %s\n", meta.ContentType)
+	}
+	for _, tag := range meta.Tags {
+		fmt.Fprintf(os.Stderr, "tag: %s=%s\n", tag[0], tag[1])
+	}
+}
 
+// isPacked reports whether the message is a tar archive of several inputs packed by embed,
+// as opposed to a single .tar file, which is embedded along with its name
+func isPacked(header *process.Header) bool {
+	return header.Name == "" && tarball.IsTarball(header.SrcType)
+}
+
+// listMessage prints the contents of an embedded tar archive, or the single embedded file
+func listMessage(header *process.Header, message []byte) error {
+	if !isPacked(header) {
+		name := "message.txt"
+		if header.Name != "" {
+			name = header.Name + header.SrcType
+		}
+		mode := header.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		fmt.Fprintf(os.Stdout, "%v %10d %s\n", mode, len(message), name)
+		return nil
+	}
+	entries, err := tarball.List(message)
+	if err != nil {
+		return fmt.Errorf("failed to list message: %v", err)
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(os.Stdout, "%v %10d %s\n", entry.FileInfo().Mode(), entry.Size, entry.Name)
+	}
+	return nil
+}
+
+func DecodeMessage(header *process.Header, extracted []byte) ([]byte, error) {
 	if header.PreEncoding == "" {
-		return msg, nil
+		return extracted, nil
 	}
 
 	encStrings := strings.Split(header.PreEncoding, "/")
-	preEncoders, warnings := encoders.FromIntStrSlice(encStrings)
+	preEncoders, warnings := encoders.FromHeaderCodes(encStrings)
 	if warnings != "" {
-		return "", fmt.Errorf("failed to determine pre-encoders (%v): %s", encStrings, warnings)
-	}
-	for _, enc := range preEncoders {
-		switch enc {
-		case encoders.R13:
-			msg = encoders.Rot13(msg)
-		case encoders.B16:
-			msg, err = encoders.Decode16(msg)
-			if err != nil {
-				return "", fmt.Errorf("failed to decode b16 message: %v", err)
-			}
-		case encoders.B32:
-			msg, err = encoders.Decode32(msg)
-			if err != nil {
-				return "", fmt.Errorf("failed to decode b32 message: %v", err)
-			}
-		case encoders.B64:
-			msg, err = encoders.Decode64(msg)
-			if err != nil {
-				return "", fmt.Errorf("failed to decode b64 message: %v", err)
-			}
-		case encoders.B85:
-			msg, err = encoders.Decode85(msg)
-			if err != nil {
-				return "", fmt.Errorf("failed to decode b85 message: %v", err)
-			}
-		case encoders.GZIP:
-			dMsg, err := encoders.Gunzip(extracted)
-			if err != nil {
-				return "", fmt.Errorf("failed to decompress message: %v", err)
-			}
-			msg = string(dMsg)
-		default:
-			return "", fmt.Errorf("attempted to decode unkown pre-encoding type: %d", enc)
-		}
+		return nil, fmt.Errorf("failed to determine pre-encoders (%v): %s", encStrings, warnings)
 	}
-	return msg, err
+	return encoders.RemovePreEncoding(extracted, preEncoders)
 }
@@ -2,21 +2,26 @@ package extractor
 
 import (
 	"fmt"
-	"image/gif"
 	"io"
 
+	"github.com/bshore/steggo/pkg/giffile"
 	"github.com/bshore/steggo/pkg/process"
 )
 
-func ProcessGif(src io.Reader) (string, error) {
-	loadedImage, err := gif.DecodeAll(src)
+func ProcessGif(src io.Reader) (*process.Header, []byte, error) {
+	loadedImage, err := giffile.Decode(src)
 	if err != nil {
-		return "", fmt.Errorf("error decoding GIF file: %v", err)
+		return nil, nil, fmt.Errorf("error decoding GIF file: %v", err)
 	}
 
 	header, extracted, err := process.ExtractMsgFromGIF(loadedImage)
 	if err != nil {
-		return "", fmt.Errorf("error extracting from GIF image: %v", err)
+		// The message may have been embedded in the pixel indices instead of the palette
+		var indexErr error
+		header, extracted, indexErr = process.ExtractMsgFromGIFIndices(loadedImage)
+		if indexErr != nil {
+			return nil, nil, fmt.Errorf("error extracting from GIF image: %v", err)
+		}
 	}
-	return DecodeMessage(header, extracted)
+	return header, extracted, nil
 }
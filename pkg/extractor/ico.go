@@ -0,0 +1,49 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/ico"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessICO extracts the piece of the message held by each image in an ICO/CUR file
+// and joins them back together, failing when a piece is missing or cut short.
+func ProcessICO(src io.Reader) (*process.Header, []byte, error) {
+	loaded, err := ico.Decode(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding ICO file: %v", err)
+	}
+	var headers []*process.Header
+	var pieces [][]byte
+	for i := range loaded.Entries {
+		img, err := loaded.Entries[i].Image()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding icon image %d: %v", i, err)
+		}
+		chunkHeader, chunk, err := process.ExtractMsgFromImage(img)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error extracting from icon image %d: %v", i, err)
+		}
+		if chunkHeader.Shard == nil {
+			return nil, nil, fmt.Errorf("icon image %d holds a whole message instead of a piece of one", i)
+		}
+		if len(chunk) != chunkHeader.Size {
+			return nil, nil, fmt.Errorf("icon image %d holds %d of its %d bytes, the message is truncated", i, len(chunk), chunkHeader.Size)
+		}
+		headers = append(headers, chunkHeader)
+		pieces = append(pieces, chunk)
+	}
+	if len(headers) == 0 {
+		return nil, nil, fmt.Errorf("icon file contains no images")
+	}
+	if total := headers[0].Shard.Total; len(headers) < total {
+		return nil, nil, fmt.Errorf("icon holds %d of the message's %d pieces, an image is missing", len(headers), total)
+	}
+	header, msg, err := process.JoinShards(headers, pieces)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error joining the pieces held by the icon images: %v", err)
+	}
+	return header, msg, nil
+}
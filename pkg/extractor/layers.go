@@ -0,0 +1,22 @@
+package extractor
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessLayer extracts the layer embedded under the passphrase from a png or bmp image
+func ProcessLayer(src io.Reader, passphrase string) (*process.Header, []byte, error) {
+	loadedImage, _, err := image.Decode(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding image file: %v", err)
+	}
+	header, extracted, err := process.ExtractLayer(loadedImage, passphrase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error extracting layer from image: %v", err)
+	}
+	return header, extracted, nil
+}
@@ -0,0 +1,21 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/midi"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+func ProcessMIDI(src io.Reader) (*process.Header, []byte, error) {
+	loaded, err := midi.Decode(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding MIDI file: %v", err)
+	}
+	header, extracted, err := process.ExtractMsgFromMIDI(loaded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error extracting from MIDI file: %v", err)
+	}
+	return header, extracted, nil
+}
@@ -8,14 +8,14 @@ import (
 	"github.com/bshore/steggo/pkg/process"
 )
 
-func ProcessPNG(src io.Reader) (string, error) {
+func ProcessPNG(src io.Reader) (*process.Header, []byte, error) {
 	loadedImage, err := png.Decode(src)
 	if err != nil {
-		return "", fmt.Errorf("error decoding PNG file: %v", err)
+		return nil, nil, fmt.Errorf("error decoding PNG file: %v", err)
 	}
 	header, extracted, err := process.ExtractMsgFromImage(loadedImage)
 	if err != nil {
-		return "", fmt.Errorf("error extracting from image: %v", err)
+		return nil, nil, fmt.Errorf("error extracting from image: %v", err)
 	}
-	return DecodeMessage(header, extracted)
+	return header, extracted, nil
 }
@@ -0,0 +1,21 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/y4m"
+)
+
+func ProcessY4M(src io.Reader) (*process.Header, []byte, error) {
+	loaded, err := y4m.Decode(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding Y4M file: %v", err)
+	}
+	header, extracted, err := process.ExtractMsgFromY4M(loaded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error extracting from Y4M video: %v", err)
+	}
+	return header, extracted, nil
+}
@@ -0,0 +1,21 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/ziparchive"
+)
+
+func ProcessZip(src io.Reader) (*process.Header, []byte, error) {
+	loaded, err := ziparchive.Decode(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding ZIP file: %v", err)
+	}
+	header, extracted, err := process.ExtractMsgFromZip(loaded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error extracting from ZIP archive: %v", err)
+	}
+	return header, extracted, nil
+}
@@ -0,0 +1,348 @@
+// Package giffile reads and writes GIF files block by block. Unlike image/gif it keeps the
+// global color table, every extension block (comments, NETSCAPE loop counts, XMP and other
+// application data) and the compressed image data of untouched frames exactly as they were
+// read, so a GIF can be written back with only the parts that were deliberately changed.
+package giffile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/lzw"
+	"fmt"
+	"io"
+)
+
+const (
+	extensionIntroducer = 0x21
+	imageSeparator      = 0x2C
+	trailer             = 0x3B
+
+	graphicControlLabel = 0xF9
+
+	colorTableFlag = 0x80
+	interlaceFlag  = 0x40
+)
+
+// GIF is a GIF file split into its blocks
+type GIF struct {
+	// Header holds the signature and the logical screen descriptor
+	Header      []byte
+	GlobalTable []byte
+	Blocks      []*Block
+}
+
+// Block is either an extension, kept as raw bytes, or an image
+type Block struct {
+	Extension []byte
+	Image     *Frame
+}
+
+// Frame is an image block along with the graphic control extension that applies to it
+type Frame struct {
+	Descriptor  []byte
+	LocalTable  []byte
+	MinCodeSize byte
+	// Data holds the LZW compressed pixel indices without the sub-block framing
+	Data []byte
+
+	control []byte
+	indices []byte
+	changed bool
+	// raw holds the image data sub-blocks as read, written back as-is when the
+	// indices haven't changed
+	raw []byte
+}
+
+// Decode splits a GIF file into its blocks
+func Decode(r io.Reader) (*GIF, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GIF: %v", err)
+	}
+	if len(data) < 13 || !bytes.HasPrefix(data, []byte("GIF8")) {
+		return nil, fmt.Errorf("invalid GIF header")
+	}
+	file := &GIF{Header: bytes.Clone(data[:13])}
+	pos := 13
+	if file.Header[10]&colorTableFlag != 0 {
+		size := tableLen(file.Header[10])
+		if pos+size > len(data) {
+			return nil, fmt.Errorf("global color table is truncated")
+		}
+		file.GlobalTable = bytes.Clone(data[pos : pos+size])
+		pos += size
+	}
+
+	var control []byte
+	for pos < len(data) {
+		switch data[pos] {
+		case trailer:
+			return file, nil
+		case extensionIntroducer:
+			if pos+2 > len(data) {
+				return nil, fmt.Errorf("extension at offset %d is truncated", pos)
+			}
+			end, _ := readSubBlocks(data, pos+2)
+			if end > len(data) {
+				return nil, fmt.Errorf("extension at offset %d is truncated", pos)
+			}
+			ext := bytes.Clone(data[pos:end])
+			if data[pos+1] == graphicControlLabel {
+				control = ext
+			}
+			file.Blocks = append(file.Blocks, &Block{Extension: ext})
+			pos = end
+		case imageSeparator:
+			if pos+11 > len(data) {
+				return nil, fmt.Errorf("image descriptor at offset %d is truncated", pos)
+			}
+			frame := &Frame{Descriptor: bytes.Clone(data[pos : pos+10]), control: control}
+			control = nil
+			pos += 10
+			if frame.Descriptor[9]&colorTableFlag != 0 {
+				size := tableLen(frame.Descriptor[9])
+				if pos+size > len(data) {
+					return nil, fmt.Errorf("local color table at offset %d is truncated", pos)
+				}
+				frame.LocalTable = bytes.Clone(data[pos : pos+size])
+				pos += size
+			}
+			if pos >= len(data) {
+				return nil, fmt.Errorf("image data at offset %d is truncated", pos)
+			}
+			frame.MinCodeSize = data[pos]
+			end, compressed := readSubBlocks(data, pos+1)
+			if end > len(data) {
+				return nil, fmt.Errorf("image data at offset %d is truncated", pos)
+			}
+			frame.Data = compressed
+			frame.raw = bytes.Clone(data[pos+1 : end])
+			file.Blocks = append(file.Blocks, &Block{Image: frame})
+			pos = end
+		default:
+			return nil, fmt.Errorf("unexpected block 0x%02x at offset %d", data[pos], pos)
+		}
+	}
+	// Some encoders leave off the trailer, the blocks read so far are still usable
+	return file, nil
+}
+
+// Encode writes the GIF back out, re-compressing only the frames whose pixel indices changed
+func Encode(w io.Writer, file *GIF) error {
+	bw := bufio.NewWriter(w)
+	header := bytes.Clone(file.Header)
+	header[10] = withTable(header[10], file.GlobalTable)
+	bw.Write(header)
+	bw.Write(file.GlobalTable)
+
+	for _, block := range file.Blocks {
+		if block.Image == nil {
+			bw.Write(block.Extension)
+			continue
+		}
+		frame := block.Image
+		if frame.changed {
+			err := frame.compress()
+			if err != nil {
+				return err
+			}
+		}
+		descriptor := bytes.Clone(frame.Descriptor)
+		descriptor[9] = withTable(descriptor[9], frame.LocalTable)
+		bw.Write(descriptor)
+		bw.Write(frame.LocalTable)
+		bw.WriteByte(frame.MinCodeSize)
+		if frame.raw != nil {
+			bw.Write(frame.raw)
+		} else {
+			writeSubBlocks(bw, frame.Data)
+		}
+	}
+	bw.WriteByte(trailer)
+	return bw.Flush()
+}
+
+// Frames returns the image blocks in file order
+func (g *GIF) Frames() []*Frame {
+	var frames []*Frame
+	for _, block := range g.Blocks {
+		if block.Image != nil {
+			frames = append(frames, block.Image)
+		}
+	}
+	return frames
+}
+
+// Table returns the color table the frame is drawn with, its local table or the global one
+func (g *GIF) Table(f *Frame) []byte {
+	if f.LocalTable != nil {
+		return f.LocalTable
+	}
+	return g.GlobalTable
+}
+
+// SetTable replaces the color table the frame is drawn with. The table must hold a power
+// of two number of colors between 2 and 256.
+func (g *GIF) SetTable(f *Frame, table []byte) {
+	if f.LocalTable != nil {
+		f.LocalTable = table
+	} else {
+		g.GlobalTable = table
+	}
+}
+
+// BackgroundIndex returns the global color table index of the background color
+func (g *GIF) BackgroundIndex() int {
+	return int(g.Header[11])
+}
+
+// Width returns the frame width
+func (f *Frame) Width() int {
+	return int(f.Descriptor[5]) | int(f.Descriptor[6])<<8
+}
+
+// Height returns the frame height
+func (f *Frame) Height() int {
+	return int(f.Descriptor[7]) | int(f.Descriptor[8])<<8
+}
+
+// Disposal returns the frame's disposal method from its graphic control extension
+func (f *Frame) Disposal() byte {
+	if len(f.control) < 8 {
+		return 0
+	}
+	return (f.control[3] >> 2) & 0x07
+}
+
+// TransparentIndex returns the frame's transparent color index, or -1 when it has none
+func (f *Frame) TransparentIndex() int {
+	if len(f.control) < 8 || f.control[3]&0x01 == 0 {
+		return -1
+	}
+	return int(f.control[6])
+}
+
+// Indices decompresses the frame's pixel indices in row order
+func (f *Frame) Indices() ([]byte, error) {
+	if f.indices != nil {
+		return f.indices, nil
+	}
+	litWidth := int(f.MinCodeSize)
+	if litWidth < 2 || litWidth > 8 {
+		return nil, fmt.Errorf("invalid LZW minimum code size: %d", litWidth)
+	}
+	pixels := f.Width() * f.Height()
+	reader := lzw.NewReader(bytes.NewReader(f.Data), lzw.LSB, litWidth)
+	defer reader.Close()
+	stored := make([]byte, pixels)
+	_, err := io.ReadFull(reader, stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress image data: %v", err)
+	}
+	f.indices = f.deinterlace(stored)
+	return f.indices, nil
+}
+
+// SetIndices replaces the frame's pixel indices, given in row order
+func (f *Frame) SetIndices(indices []byte) {
+	f.indices = indices
+	f.changed = true
+}
+
+func (f *Frame) compress() error {
+	var buf bytes.Buffer
+	writer := lzw.NewWriter(&buf, lzw.LSB, int(f.MinCodeSize))
+	_, err := writer.Write(f.interlace(f.indices))
+	if err != nil {
+		return fmt.Errorf("failed to compress image data: %v", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to compress image data: %v", err)
+	}
+	f.Data = buf.Bytes()
+	f.raw = nil
+	f.changed = false
+	return nil
+}
+
+// interlacedRows returns the order rows are stored in for an interlaced frame
+func (f *Frame) interlacedRows() []int {
+	var rows []int
+	for _, pass := range [][2]int{{0, 8}, {4, 8}, {2, 4}, {1, 2}} {
+		for y := pass[0]; y < f.Height(); y += pass[1] {
+			rows = append(rows, y)
+		}
+	}
+	return rows
+}
+
+func (f *Frame) deinterlace(stored []byte) []byte {
+	if f.Descriptor[9]&interlaceFlag == 0 {
+		return stored
+	}
+	width := f.Width()
+	out := make([]byte, len(stored))
+	for i, y := range f.interlacedRows() {
+		copy(out[y*width:(y+1)*width], stored[i*width:(i+1)*width])
+	}
+	return out
+}
+
+func (f *Frame) interlace(indices []byte) []byte {
+	if f.Descriptor[9]&interlaceFlag == 0 {
+		return indices
+	}
+	width := f.Width()
+	out := make([]byte, len(indices))
+	for i, y := range f.interlacedRows() {
+		copy(out[i*width:(i+1)*width], indices[y*width:(y+1)*width])
+	}
+	return out
+}
+
+// tableLen returns the byte length of the color table described by a packed field
+func tableLen(packed byte) int {
+	return 3 * (1 << ((packed & 0x07) + 1))
+}
+
+// withTable updates a packed field's color table flag and size to describe table
+func withTable(packed byte, table []byte) byte {
+	packed &^= colorTableFlag | 0x07
+	if table == nil {
+		return packed
+	}
+	bits := byte(0)
+	for 3*(1<<(bits+1)) < len(table) {
+		bits++
+	}
+	return packed | colorTableFlag | bits
+}
+
+// readSubBlocks returns the offset just past a sub-block sequence and the joined data
+func readSubBlocks(data []byte, pos int) (int, []byte) {
+	var out []byte
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, out
+		}
+		if pos+size > len(data) {
+			return len(data) + 1, nil
+		}
+		out = append(out, data[pos:pos+size]...)
+		pos += size
+	}
+	return len(data) + 1, nil
+}
+
+func writeSubBlocks(w *bufio.Writer, data []byte) {
+	for len(data) > 0 {
+		n := min(len(data), 255)
+		w.WriteByte(byte(n))
+		w.Write(data[:n])
+		data = data[n:]
+	}
+	w.WriteByte(0)
+}
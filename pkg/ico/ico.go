@@ -0,0 +1,258 @@
+// Package ico reads and writes Windows ICO and CUR files, which bundle several
+// PNG or BMP images of different sizes behind a small directory.
+package ico
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+const (
+	// TypeICO is the resource type of an icon file
+	TypeICO uint16 = 1
+	// TypeCUR is the resource type of a cursor file
+	TypeCUR uint16 = 2
+
+	headerLen   = 6
+	dirEntryLen = 16
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Entry is a single image in the icon directory.
+//
+// For icons Planes and BitCount hold the color planes and bits per pixel, for
+// cursors they hold the X and Y hotspot coordinates instead.
+type Entry struct {
+	Width      int
+	Height     int
+	ColorCount uint8
+	Planes     uint16
+	BitCount   uint16
+	Data       []byte
+}
+
+// ICO is a decoded icon or cursor file
+type ICO struct {
+	Type    uint16
+	Entries []Entry
+}
+
+// IsICO reports whether b starts with an ICO or CUR header
+func IsICO(b []byte) bool {
+	if len(b) < headerLen {
+		return false
+	}
+	resType := binary.LittleEndian.Uint16(b[2:4])
+	return binary.LittleEndian.Uint16(b[0:2]) == 0 &&
+		(resType == TypeICO || resType == TypeCUR) &&
+		binary.LittleEndian.Uint16(b[4:6]) > 0
+}
+
+// Decode reads an ICO or CUR file and its directory entries
+func Decode(r io.Reader) (*ICO, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read icon: %v", err)
+	}
+	if !IsICO(data) {
+		return nil, fmt.Errorf("invalid icon header")
+	}
+	file := &ICO{Type: binary.LittleEndian.Uint16(data[2:4])}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	if len(data) < headerLen+count*dirEntryLen {
+		return nil, fmt.Errorf("icon directory is truncated")
+	}
+	for i := 0; i < count; i++ {
+		d := data[headerLen+i*dirEntryLen:]
+		size := int(binary.LittleEndian.Uint32(d[8:12]))
+		offset := int(binary.LittleEndian.Uint32(d[12:16]))
+		if offset+size > len(data) {
+			return nil, fmt.Errorf("icon entry %d is out of bounds", i)
+		}
+		file.Entries = append(file.Entries, Entry{
+			Width:      dimension(d[0]),
+			Height:     dimension(d[1]),
+			ColorCount: d[2],
+			Planes:     binary.LittleEndian.Uint16(d[4:6]),
+			BitCount:   binary.LittleEndian.Uint16(d[6:8]),
+			Data:       data[offset : offset+size],
+		})
+	}
+	return file, nil
+}
+
+// Encode writes the icon, recomputing every directory entry's size and offset
+func Encode(w io.Writer, file *ICO) error {
+	var buf bytes.Buffer
+	buf.Write(binary.LittleEndian.AppendUint16(nil, 0))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, file.Type))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(file.Entries))))
+
+	offset := headerLen + len(file.Entries)*dirEntryLen
+	for _, e := range file.Entries {
+		d := make([]byte, dirEntryLen)
+		d[0] = dimensionByte(e.Width)
+		d[1] = dimensionByte(e.Height)
+		d[2] = e.ColorCount
+		binary.LittleEndian.PutUint16(d[4:6], e.Planes)
+		binary.LittleEndian.PutUint16(d[6:8], e.BitCount)
+		binary.LittleEndian.PutUint32(d[8:12], uint32(len(e.Data)))
+		binary.LittleEndian.PutUint32(d[12:16], uint32(offset))
+		buf.Write(d)
+		offset += len(e.Data)
+	}
+	for _, e := range file.Entries {
+		buf.Write(e.Data)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// IsPNG reports whether the entry holds a PNG image rather than a BMP
+func (e *Entry) IsPNG() bool {
+	return bytes.HasPrefix(e.Data, pngSignature)
+}
+
+// Image decodes the entry's PNG or BMP image
+func (e *Entry) Image() (image.Image, error) {
+	if e.IsPNG() {
+		return png.Decode(bytes.NewReader(e.Data))
+	}
+	return decodeDIB(e.Data)
+}
+
+// SetImage replaces the entry's image, storing it as an 8 bit RGBA PNG.
+//
+//	The embedded message lives in the low bits of the color values, which an icon's BMP format
+//	with its AND mask can't hold, so every image written back is a PNG regardless of how it was
+//	originally stored. Windows only accepts PNG entries with 8 bits per channel, hence NRGBA.
+func (e *Entry) SetImage(img *image.NRGBA, resType uint16) error {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return fmt.Errorf("failed to encode icon image: %v", err)
+	}
+	e.Data = buf.Bytes()
+	e.Width = img.Bounds().Dx()
+	e.Height = img.Bounds().Dy()
+	e.ColorCount = 0
+	if resType == TypeICO {
+		e.Planes = 1
+		e.BitCount = 32
+	}
+	return nil
+}
+
+// decodeDIB decodes the headerless bitmap stored in an icon entry, which is a
+// BITMAPINFOHEADER followed by the color table, XOR bitmap and the 1 bit AND mask.
+func decodeDIB(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("icon bitmap header is truncated")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data[0:4]))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:8])))
+	// The height covers both the XOR bitmap and the AND mask
+	height := int(int32(binary.LittleEndian.Uint32(data[8:12]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:16]))
+	compression := binary.LittleEndian.Uint32(data[16:20])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:36]))
+	if compression != 0 {
+		return nil, fmt.Errorf("compressed icon bitmaps are not supported")
+	}
+	if width <= 0 || height <= 0 || headerSize > len(data) {
+		return nil, fmt.Errorf("invalid icon bitmap dimensions %dx%d", width, height)
+	}
+
+	pos := headerSize
+	var palette color.Palette
+	if bitCount <= 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 1 << bitCount
+		}
+		if pos+colorsUsed*4 > len(data) {
+			return nil, fmt.Errorf("icon bitmap color table is truncated")
+		}
+		for i := 0; i < colorsUsed; i++ {
+			c := data[pos+i*4:]
+			palette = append(palette, color.NRGBA{R: c[2], G: c[1], B: c[0], A: 0xFF})
+		}
+		pos += colorsUsed * 4
+	}
+
+	stride := ((width*bitCount + 31) / 32) * 4
+	maskStride := ((width + 31) / 32) * 4
+	if pos+stride*height > len(data) {
+		return nil, fmt.Errorf("icon bitmap pixel data is truncated")
+	}
+	pixels := data[pos : pos+stride*height]
+	var mask []byte
+	if pos+stride*height+maskStride*height <= len(data) {
+		mask = data[pos+stride*height : pos+stride*height+maskStride*height]
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var hasAlpha bool
+	for y := 0; y < height; y++ {
+		// Rows are stored bottom-up
+		row := pixels[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bitCount {
+			case 1, 4, 8:
+				bit := x * bitCount
+				idx := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if idx >= len(palette) {
+					return nil, fmt.Errorf("icon bitmap color index %d out of range", idx)
+				}
+				c = palette[idx].(color.NRGBA)
+			case 24:
+				c = color.NRGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 0xFF}
+			case 32:
+				c = color.NRGBA{R: row[x*4+2], G: row[x*4+1], B: row[x*4], A: row[x*4+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			default:
+				return nil, fmt.Errorf("unsupported icon bitmap depth: %d", bitCount)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// 32 bit bitmaps carry their own alpha channel, everything else relies on the AND mask
+	if hasAlpha || mask == nil {
+		return img, nil
+	}
+	for y := 0; y < height; y++ {
+		row := mask[(height-1-y)*maskStride:]
+		for x := 0; x < width; x++ {
+			c := img.NRGBAAt(x, y)
+			if row[x/8]&(0x80>>(x%8)) != 0 {
+				c.A = 0
+			} else {
+				c.A = 0xFF
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// dimension converts a directory width/height byte, where 0 means 256
+func dimension(b byte) int {
+	if b == 0 {
+		return 256
+	}
+	return int(b)
+}
+
+func dimensionByte(d int) byte {
+	if d >= 256 {
+		return 0
+	}
+	return byte(d)
+}
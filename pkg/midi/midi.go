@@ -0,0 +1,216 @@
+// Package midi reads and writes Standard MIDI Files down to the event level, keeping
+// every event's bytes (including running status) exactly as they were read.
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	headerChunk = "MThd"
+	trackChunk  = "MTrk"
+)
+
+// File is a decoded Standard MIDI File
+type File struct {
+	Chunks []*Chunk
+}
+
+// Chunk is a single chunk of the file. Track chunks are decoded into Events,
+// any other chunk keeps its raw Data.
+type Chunk struct {
+	Type   string
+	Data   []byte
+	Events []*Event
+}
+
+// Event is a single track event. Raw holds the event bytes as stored, which may
+// omit the status byte when the track uses running status.
+type Event struct {
+	Delta  uint32
+	Raw    []byte
+	status byte
+}
+
+// IsMIDI reports whether b starts with a MIDI header chunk
+func IsMIDI(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(headerChunk))
+}
+
+// Decode reads every chunk of a MIDI file, decoding the events of each track
+func Decode(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MIDI file: %v", err)
+	}
+	if !IsMIDI(data) {
+		return nil, fmt.Errorf("MIDI header chunk not found")
+	}
+	file := &File{}
+	pos := 0
+	for pos+8 <= len(data) {
+		chunkType := string(data[pos : pos+4])
+		length := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		if pos+8+length > len(data) {
+			return nil, fmt.Errorf("%s chunk at offset %d is truncated", chunkType, pos)
+		}
+		chunk := &Chunk{Type: chunkType, Data: data[pos+8 : pos+8+length]}
+		if chunkType == trackChunk {
+			chunk.Events, err = decodeEvents(chunk.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode track %d: %v", len(file.Tracks()), err)
+			}
+		}
+		file.Chunks = append(file.Chunks, chunk)
+		pos += 8 + length
+	}
+	return file, nil
+}
+
+// Encode writes every chunk, re-encoding track chunks from their events
+func Encode(w io.Writer, file *File) error {
+	var buf bytes.Buffer
+	for _, chunk := range file.Chunks {
+		data := chunk.Data
+		if chunk.Type == trackChunk {
+			data = encodeEvents(chunk.Events)
+		}
+		buf.WriteString(chunk.Type)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+		buf.Write(data)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Tracks returns the track chunks in file order
+func (f *File) Tracks() []*Chunk {
+	var tracks []*Chunk
+	for _, chunk := range f.Chunks {
+		if chunk.Type == trackChunk {
+			tracks = append(tracks, chunk)
+		}
+	}
+	return tracks
+}
+
+// IsNoteOn reports whether the event is a note-on with a non-zero velocity. A note-on
+// with a velocity of zero is a note-off.
+func (e *Event) IsNoteOn() bool {
+	return e.status&0xF0 == 0x90 && e.Velocity() > 0
+}
+
+// Velocity returns the velocity of a note event
+func (e *Event) Velocity() byte {
+	return e.Raw[len(e.Raw)-1]
+}
+
+// SetVelocity changes the velocity of a note event
+func (e *Event) SetVelocity(v byte) {
+	e.Raw[len(e.Raw)-1] = v & 0x7F
+}
+
+func decodeEvents(data []byte) ([]*Event, error) {
+	var events []*Event
+	var runningStatus byte
+	pos := 0
+	for pos < len(data) {
+		delta, n, err := readVarLen(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		if pos >= len(data) {
+			return nil, fmt.Errorf("event at offset %d is truncated", pos)
+		}
+
+		start := pos
+		status := data[pos]
+		switch {
+		case status == 0xFF:
+			// Meta event: type, length, data
+			if pos+2 > len(data) {
+				return nil, fmt.Errorf("meta event at offset %d is truncated", pos)
+			}
+			length, n, err := readVarLen(data[pos+2:])
+			if err != nil {
+				return nil, err
+			}
+			pos += 2 + n + int(length)
+			// Meta and system exclusive events cancel running status
+			runningStatus = 0
+		case status == 0xF0 || status == 0xF7:
+			// System exclusive event: length, data
+			length, n, err := readVarLen(data[pos+1:])
+			if err != nil {
+				return nil, err
+			}
+			pos += 1 + n + int(length)
+			runningStatus = 0
+		case status > 0xF0:
+			return nil, fmt.Errorf("unsupported system event 0x%02x at offset %d", status, pos)
+		default:
+			if status&0x80 != 0 {
+				runningStatus = status
+				pos++
+			} else if runningStatus == 0 {
+				return nil, fmt.Errorf("data byte without running status at offset %d", pos)
+			}
+			status = runningStatus
+			pos += channelDataLen(status)
+		}
+		if pos > len(data) {
+			return nil, fmt.Errorf("event at offset %d is truncated", start)
+		}
+		events = append(events, &Event{
+			Delta:  delta,
+			Raw:    bytes.Clone(data[start:pos]),
+			status: status,
+		})
+	}
+	return events, nil
+}
+
+func encodeEvents(events []*Event) []byte {
+	var out []byte
+	for _, e := range events {
+		out = appendVarLen(out, e.Delta)
+		out = append(out, e.Raw...)
+	}
+	return out
+}
+
+// channelDataLen returns the number of data bytes that follow a channel message status
+func channelDataLen(status byte) int {
+	switch status & 0xF0 {
+	case 0xC0, 0xD0:
+		return 1
+	}
+	return 2
+}
+
+// readVarLen reads a variable length quantity of up to 4 bytes
+func readVarLen(b []byte) (uint32, int, error) {
+	var v uint32
+	for i := 0; i < 4 && i < len(b); i++ {
+		v = v<<7 | uint32(b[i]&0x7F)
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid variable length quantity")
+}
+
+func appendVarLen(b []byte, v uint32) []byte {
+	var tmp [4]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7F)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7F) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
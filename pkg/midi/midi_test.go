@@ -0,0 +1,30 @@
+package midi
+
+import (
+	"bytes"
+	"testing"
+)
+
+// track wraps the event bytes in a format 0 file with a single track
+func track(events ...byte) []byte {
+	b := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96}
+	b = append(b, 'M', 'T', 'r', 'k', 0, 0, 0, byte(len(events)))
+	return append(b, events...)
+}
+
+func TestRunningStatusIsCancelled(t *testing.T) {
+	tests := map[string][]byte{
+		"running status":     {0, 0x90, 60, 64, 10, 62, 64},
+		"after meta":         {0, 0x90, 60, 64, 0, 0xFF, 0x01, 1, 'a', 10, 62, 64},
+		"after sysex":        {0, 0x90, 60, 64, 0, 0xF0, 2, 0x7E, 0xF7, 10, 62, 64},
+		"new status after":   {0, 0x90, 60, 64, 0, 0xFF, 0x01, 1, 'a', 10, 0x90, 62, 64},
+		"without any status": {0, 60, 64},
+	}
+	valid := map[string]bool{"running status": true, "new status after": true}
+	for name, events := range tests {
+		_, err := Decode(bytes.NewReader(track(events...)))
+		if (err == nil) != valid[name] {
+			t.Errorf("%s: got %v, want valid=%v", name, err, valid[name])
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package process
 
+import (
+	"image"
+	"image/color"
+)
+
 /*
 	This file contains generic struct types and helper functions
 */
@@ -72,3 +77,20 @@ func extractFromColor(r, g, b uint8) byte {
 	newByte = newByte | (bBits & 7) // bbbbbbbb
 	return newByte
 }
+
+// nrgba64At returns the non-premultiplied 16 bit color values of a pixel. Using
+// color.RGBA() here would premultiply by alpha and scramble the low bits of any
+// translucent pixel.
+func nrgba64At(file image.Image, x, y int) (r, g, b, a uint32) {
+	// The color models go through premultiplied values too, so 8 bit colors are widened here
+	if c, ok := file.At(x, y).(color.NRGBA); ok {
+		return uint32(c.R) * 0x101, uint32(c.G) * 0x101, uint32(c.B) * 0x101, uint32(c.A) * 0x101
+	}
+	c := color.NRGBA64Model.Convert(file.At(x, y)).(color.NRGBA64)
+	return uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+}
+
+// bitAt returns the i'th bit of data, most significant bit of each byte first
+func bitAt(data []byte, i int) byte {
+	return (data[i/8] >> (7 - i%8)) & 1
+}
@@ -5,7 +5,8 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	"image/gif"
+
+	"github.com/bshore/steggo/pkg/giffile"
 )
 
 // EmbedMsgInImage takes the message string and embeds it
@@ -15,15 +16,17 @@ func EmbedMsgInImage(data []byte, file image.Image) (draw.Image, error) {
 	var newR, newG, newB uint16
 	bounds := file.Bounds()
 	pixels := bounds.Max.X * bounds.Max.Y
-	if !(len(data) < pixels) {
-		return nil, fmt.Errorf("message won't fit in image: %v bits to embed, %v pixels available", len(data), pixels)
+	// Each pixel holds one byte in its R, G and B values
+	if len(data)/3 > pixels {
+		return nil, fmt.Errorf("message won't fit in image: %v bytes to embed, %v pixels available", len(data)/3, pixels)
 	}
 	newFile := image.NewNRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
 	// For each vertical row
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		// For each pixel in each row
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := file.At(x, y).RGBA()
+			// Work on non-premultiplied values so translucent pixels keep their embedded bits
+			r, g, b, a := nrgba64At(file, x, y)
 			// If the iteration is still under the length of message bits
 			if bitsIndex < len(data) {
 				newR = embedIn16BitColor(data[bitsIndex], r)
@@ -60,73 +63,106 @@ func EmbedMsgInImage(data []byte, file image.Image) (draw.Image, error) {
 	return newFile, nil
 }
 
-// EmbedMsgInGIF takes the message data and embeds it into the GIF file's
-// Local Color Palette.
-func EmbedMsgInGIF(data []byte, file *gif.GIF) (*gif.GIF, error) {
-	// Find all non-embedable colors in the the whole GIF
-	var nonEmbedableColors int
-	for frameIdx := range file.Image {
-		for paletteIdx := 0; paletteIdx < len(file.Image[frameIdx].Palette); paletteIdx++ {
-			r, g, b, _ := file.Image[frameIdx].Palette[paletteIdx].RGBA()
-			r8 := uint8(r >> 8)
-			g8 := uint8(g >> 8)
-			b8 := uint8(b >> 8)
-			extractedByte := extractFromColor(r8, g8, b8)
-			if extractedByte == 0x00 {
-				nonEmbedableColors++
+// EmbedMsgInImage8 embeds the message the same way as EmbedMsgInImage, but in the low bits of
+// 8 bit color values, for formats whose images are stored with 8 bits per channel (ICO/CUR).
+// ExtractMsgFromImage reads either, since an 8 bit value widened to 16 bits keeps its low bits.
+func EmbedMsgInImage8(data []byte, file image.Image) (*image.NRGBA, error) {
+	bounds := file.Bounds()
+	pixels := bounds.Dx() * bounds.Dy()
+	if len(data)/3 > pixels {
+		return nil, fmt.Errorf("message won't fit in image: %v bytes to embed, %v pixels available", len(data)/3, pixels)
+	}
+	newFile := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	var bitsIndex int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(file.At(x, y)).(color.NRGBA)
+			channels := []*uint8{&c.R, &c.G, &c.B}
+			for i, channel := range channels {
+				if bitsIndex+i < len(data) {
+					*channel = embedInColor(data[bitsIndex+i], *channel)
+				}
 			}
+			newFile.SetNRGBA(x-bounds.Min.X, y-bounds.Min.Y, c)
+			bitsIndex += 3
 		}
 	}
-	totalCapacity := (len(file.Image) * 256 * 3) - nonEmbedableColors
-	if len(data) > totalCapacity {
-		return nil, fmt.Errorf("message won't fit: need %d data values, have %d capacity", len(data), totalCapacity)
+	return newFile, nil
+}
+
+// ImageCapacity returns the number of header and message bytes EmbedMsgInImage can fit in the image
+func ImageCapacity(file image.Image) int {
+	// Each byte takes the 3 color values of one pixel
+	return file.Bounds().Max.X * file.Bounds().Max.Y
+}
+
+// DistributePayload splits total bytes across several carriers in proportion to
+// their capacities, returning how many bytes each carrier should hold.
+func DistributePayload(total int, capacities []int) ([]int, error) {
+	var sum int
+	for _, c := range capacities {
+		sum += c
+	}
+	if total > sum {
+		return nil, fmt.Errorf("message won't fit: %d bytes to embed, %d bytes available", total, sum)
+	}
+	sizes := make([]int, len(capacities))
+	if sum == 0 {
+		return sizes, nil
+	}
+	var assigned int
+	for i, c := range capacities {
+		sizes[i] = int(int64(total) * int64(c) / int64(sum))
+		assigned += sizes[i]
+	}
+	// Hand out whatever rounding left over to the first carriers with room
+	for i := range sizes {
+		if assigned == total {
+			break
+		}
+		extra := min(capacities[i]-sizes[i], total-assigned)
+		sizes[i] += extra
+		assigned += extra
+	}
+	return sizes, nil
+}
+
+// EmbedMsgInGIF takes the message data and embeds it into the GIF file's color tables,
+// using the global color table once for every frame that shares it
+func EmbedMsgInGIF(data []byte, file *giffile.GIF) error {
+	plan, err := PlanGIFCapacity(file)
+	if err != nil {
+		return err
+	}
+	totalCapacity := GIFCapacityBytes(plan)
+	if len(data)/3 > totalCapacity {
+		return fmt.Errorf("message won't fit: %d bytes to embed, %d bytes available (%s)", len(data)/3, totalCapacity, describeGIFCapacity(plan))
 	}
 
 	bitsIndex := 0
-	for frameIdx := range file.Image {
+	for frameIdx, frame := range file.Frames() {
 		if bitsIndex >= len(data) {
 			break
 		}
+		if !plan[frameIdx].CanModifyPalette {
+			continue
+		}
 
-		for paletteIdx := 0; paletteIdx < len(file.Image[frameIdx].Palette); paletteIdx++ {
+		table := file.Table(frame)
+		for _, idx := range gifPaletteEntries(file, frame) {
 			if bitsIndex >= len(data) {
 				break
 			}
-
-			r, g, b, a := file.Image[frameIdx].Palette[paletteIdx].RGBA()
-
-			r8 := uint8(r >> 8)
-			g8 := uint8(g >> 8)
-			b8 := uint8(b >> 8)
-			a8 := uint8(a >> 8)
-
-			extractedByte := extractFromColor(r8, g8, b8)
-			if extractedByte == 0x00 {
-				// Always skip bytes that produce a zero byte,
-				// standard library GIF encoder optimizes by LSB
-				// and will destroy any LSB modificaiton we make,
-				// setting them back to 0x00
-				continue
-			}
-
-			if bitsIndex < len(data) {
-				r8 = embedInColor(data[bitsIndex], r8)
-				if bitsIndex+1 < len(data) {
-					g8 = embedInColor(data[bitsIndex+1], g8)
-					if bitsIndex+2 < len(data) {
-						b8 = embedInColor(data[bitsIndex+2], b8)
-					}
-				}
-			}
-
-			file.Image[frameIdx].Palette[paletteIdx] = color.RGBA{R: r8, G: g8, B: b8, A: a8}
+			entry := idx * 3
+			table[entry] = embedInColor(data[bitsIndex], table[entry])
+			table[entry+1] = embedInColor(data[bitsIndex+1], table[entry+1])
+			table[entry+2] = embedInColor(data[bitsIndex+2], table[entry+2])
 			bitsIndex += 3
 		}
 	}
 
 	if bitsIndex < len(data) {
-		return nil, fmt.Errorf("failed to embed all data: embedded %d of %d bytes", bitsIndex, len(data))
+		return fmt.Errorf("failed to embed all data: embedded %d of %d bytes", bitsIndex, len(data))
 	}
-
-	return file, nil
+	return nil
 }
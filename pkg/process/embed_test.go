@@ -0,0 +1,117 @@
+package process
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/bshore/steggo/pkg/encoders"
+)
+
+func randomImage(r *rand.Rand, w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = byte(r.UintN(256))
+	}
+	return img
+}
+
+// randomBlob returns binary data holding every byte value, in runs so compressors have
+// something to work with
+func randomBlob(r *rand.Rand, n int) []byte {
+	var blob []byte
+	for len(blob) < n {
+		blob = append(blob, bytes.Repeat([]byte{byte(r.UintN(256))}, 1+r.IntN(8))...)
+	}
+	return blob[:n]
+}
+
+func TestImageRoundTripEveryPreEncoder(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	blob := randomBlob(r, 2000)
+	pipelines := []string{"", encoders.AutoName, "basen:ACGT", "gzip,b64", "deflate,b58,r13", "zlib,basen:!#$%&()*+,-./"}
+	for _, name := range encoders.Names() {
+		if !strings.Contains(name, ":") {
+			pipelines = append(pipelines, name)
+		}
+	}
+	for _, pipeline := range pipelines {
+		var preEncoders []encoders.Encoder
+		if pipeline != "" {
+			var warnings string
+			preEncoders, warnings = encoders.FromStrSlice(encoders.SplitNames([]string{pipeline}))
+			if warnings != "" {
+				t.Fatalf("%s: %s", pipeline, warnings)
+			}
+		}
+		encoded, applied, err := encoders.ApplyPreEncoding(bytes.Clone(blob), preEncoders)
+		if err != nil {
+			t.Errorf("%s: encode: %v", pipeline, err)
+			continue
+		}
+		header := NewHeaderBytes(encoded, ".bin", "blob", 0600, applied, Metadata{})
+		img, err := EmbedMsgInImage(FinalizeMessage(header, encoded), randomImage(r, 120, 120))
+		if err != nil {
+			t.Errorf("%s: embed: %v", pipeline, err)
+			continue
+		}
+		found, extracted, err := ExtractMsgFromImage(img)
+		if err != nil {
+			t.Errorf("%s: extract: %v", pipeline, err)
+			continue
+		}
+		if found.SrcType != ".bin" || found.Name != "blob" || found.Mode != 0600 {
+			t.Errorf("%s: header came back as %+v", pipeline, found)
+		}
+		codes := strings.Split(found.PreEncoding, "/")
+		if found.PreEncoding == "" {
+			codes = nil
+		}
+		decoders, warnings := encoders.FromHeaderCodes(codes)
+		if warnings != "" {
+			t.Errorf("%s: header pre-encoding %q: %s", pipeline, found.PreEncoding, warnings)
+			continue
+		}
+		decoded, err := encoders.RemovePreEncoding(extracted, decoders)
+		if err != nil {
+			t.Errorf("%s: decode: %v", pipeline, err)
+			continue
+		}
+		if !bytes.Equal(decoded, blob) {
+			t.Errorf("%s: round trip changed the message", pipeline)
+		}
+	}
+}
+
+func TestImage8RoundTripThroughPNG(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	msg := randomBlob(r, 500)
+	header := NewHeaderBytes(msg, "txt", "", 0, nil, Metadata{})
+	img, err := EmbedMsgInImage8(FinalizeMessage(header, msg), randomImage(r, 48, 48))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The IHDR bit depth follows the 8 byte signature, chunk length, type, width and height
+	if depth := buf.Bytes()[24]; depth != 8 {
+		t.Fatalf("png bit depth is %d, want 8", depth)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, extracted, err := ExtractMsgFromImage(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(extracted, msg) {
+		t.Fatal("round trip changed the message")
+	}
+}
@@ -3,7 +3,8 @@ package process
 import (
 	"fmt"
 	"image"
-	"image/gif"
+
+	"github.com/bshore/steggo/pkg/giffile"
 )
 
 // ExtractMsgFromImage takes an Image that has had a message embedded
@@ -17,7 +18,7 @@ func ExtractMsgFromImage(file image.Image) (*Header, []byte, error) {
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		// For each pixel in each row
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := file.At(x, y).RGBA()
+			r, g, b, _ := nrgba64At(file, x, y)
 			if headerFound {
 				if len(msgBytes) < header.Size {
 					msgbyte := extractFromColor(uint8(r), uint8(g), uint8(b))
@@ -42,25 +43,56 @@ func ExtractMsgFromImage(file image.Image) (*Header, []byte, error) {
 	return header, msgBytes, nil
 }
 
-func ExtractMsgFromGIF(file *gif.GIF) (*Header, []byte, error) {
+// ExtractMsgFromGIF reads the message back from the GIF file's color tables, in
+// the same order they were embedded into. GIFs written by earlier versions, which
+// skipped entries reading as a zero byte, are read with that layout as a fallback
+// (see legacyGIFPaletteEntries).
+//
+// Both layouts read the same header, so the layout can't be told from whether one is
+// found. Embedding pads every color table to GifMaxColor entries while earlier versions
+// never did, so a GIF with a shorter table is read with the earlier layout first.
+func ExtractMsgFromGIF(file *giffile.GIF) (*Header, []byte, error) {
+	legacy := !gifTablesPadded(file)
+	header, msg, err := extractMsgFromGIF(file, legacy)
+	if err != nil {
+		var fallbackErr error
+		header, msg, fallbackErr = extractMsgFromGIF(file, !legacy)
+		if fallbackErr != nil {
+			return nil, nil, err
+		}
+	}
+	return header, msg, nil
+}
+
+// gifTablesPadded reports whether every color table of the GIF holds GifMaxColor entries
+func gifTablesPadded(file *giffile.GIF) bool {
+	for _, frame := range file.Frames() {
+		if table := file.Table(frame); table != nil && len(table)/3 < GifMaxColor {
+			return false
+		}
+	}
+	return true
+}
+
+func extractMsgFromGIF(file *giffile.GIF, legacy bool) (*Header, []byte, error) {
 	var headBytes, msgBytes []byte
 	var headerFound bool
 	var header = &Header{}
 
-	for frameIdx := range file.Image {
-		for paletteIdx := 0; paletteIdx < len(file.Image[frameIdx].Palette); paletteIdx++ {
-			r, g, b, _ := file.Image[frameIdx].Palette[paletteIdx].RGBA()
-			r8 := uint8(r >> 8)
-			g8 := uint8(g >> 8)
-			b8 := uint8(b >> 8)
-
-			extractedByte := extractFromColor(r8, g8, b8)
-			if extractedByte == 0x00 {
-				// Always skip zero bytes.
-				// Embedder does not embed in zero bytes
-				// because it leads to message corruption.
-				continue
-			}
+	plan, err := PlanGIFCapacity(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	for frameIdx, frame := range file.Frames() {
+		table := file.Table(frame)
+		var entries []int
+		if legacy {
+			entries = legacyGIFPaletteEntries(table, frame)
+		} else if plan[frameIdx].CanModifyPalette {
+			entries = gifPaletteEntries(file, frame)
+		}
+		for _, idx := range entries {
+			extractedByte := extractFromColor(table[idx*3], table[idx*3+1], table[idx*3+2])
 
 			if headerFound {
 				if len(msgBytes) < header.Size {
@@ -78,7 +110,7 @@ func ExtractMsgFromGIF(file *gif.GIF) (*Header, []byte, error) {
 	}
 
 	if !headerFound {
-		return nil, nil, fmt.Errorf("failed to extract message, header not found: %s", string(headBytes[:20]))
+		return nil, nil, fmt.Errorf("failed to extract message, header not found: %s", string(headBytes[:min(len(headBytes), 20)]))
 	}
 
 	if len(msgBytes) < header.Size {
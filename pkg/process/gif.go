@@ -0,0 +1,159 @@
+package process
+
+import (
+	"fmt"
+	"image/gif"
+	"strings"
+
+	"github.com/bshore/steggo/pkg/giffile"
+)
+
+/*
+	This file contains the capacity planning for embedding in GIF color tables.
+*/
+
+// PlanGIFCapacity analyses every frame of the GIF and returns how much of the message each
+// frame's color table can hold, so a message that won't fit is rejected before any work is done.
+// Frames that share the global color table with an earlier frame can't modify it again.
+func PlanGIFCapacity(file *giffile.GIF) ([]GifFrameCapacity, error) {
+	frames := file.Frames()
+	plan := make([]GifFrameCapacity, len(frames))
+	var globalCounted bool
+	for frameIdx, frame := range frames {
+		frameCap := GifFrameCapacity{
+			FrameIndex:     frameIdx,
+			DisposalMethod: frame.Disposal(),
+		}
+
+		indices, err := frame.Indices()
+		if err != nil {
+			return nil, fmt.Errorf("error reading frame %d: %v", frameIdx, err)
+		}
+		var used [GifMaxColor]bool
+		for _, idx := range indices {
+			used[idx] = true
+		}
+		for idx := 0; idx < GifMaxColor; idx++ {
+			if !used[idx] {
+				frameCap.UnusedIndices = append(frameCap.UnusedIndices, idx)
+			}
+		}
+
+		table := file.Table(frame)
+		if frame.LocalTable != nil {
+			frameCap.CanModifyPalette = true
+		} else if table != nil && !globalCounted {
+			globalCounted = true
+			frameCap.CanModifyPalette = true
+		}
+		if frameCap.CanModifyPalette {
+			frameCap.Capacity = 8 * len(gifPaletteEntries(file, frame))
+		}
+		plan[frameIdx] = frameCap
+	}
+	return plan, nil
+}
+
+// gifPaletteEntries lists the color table entries of the frame that can hold a message byte,
+// in the order they're embedded into. It leaves out the transparent index of every frame
+// drawn with the table, since decoders are free to throw its color away, and the background
+// color of the global table when a frame disposes to the background and may reveal it.
+//
+// The list only depends on the table size and the frames' control extensions, none of which
+// embedding changes, so extraction always walks exactly the entries embedding wrote.
+//
+// Entries no pixel uses are kept: they never reach the screen, so changing them can't affect
+// rendering. The one unused entry a decoder may still draw is the background color, which is
+// already left out whenever a frame disposes to it. GIFs written by earlier versions are laid
+// out differently, see legacyGIFPaletteEntries.
+func gifPaletteEntries(file *giffile.GIF, frame *giffile.Frame) []int {
+	table := file.Table(frame)
+	var excluded [GifMaxColor]bool
+	if frame.LocalTable != nil {
+		if t := frame.TransparentIndex(); t >= 0 {
+			excluded[t] = true
+		}
+	} else {
+		for _, f := range file.Frames() {
+			if f.LocalTable != nil {
+				continue
+			}
+			if t := f.TransparentIndex(); t >= 0 {
+				excluded[t] = true
+			}
+			if f.Disposal() == gif.DisposalBackground {
+				excluded[file.BackgroundIndex()] = true
+			}
+		}
+	}
+
+	var entries []int
+	for idx := 0; idx < len(table)/3 && idx < GifMaxColor; idx++ {
+		if excluded[idx] {
+			continue
+		}
+		entries = append(entries, idx)
+	}
+	return entries
+}
+
+// legacyGIFPaletteEntries lists the entries GIFs written by earlier versions hold the message
+// in. Those copied the global color table into every frame and walked every entry of every
+// frame, as the standard library decoder hands them out, skipping the ones reading as a zero
+// byte. That decoder blanks each frame's transparent entry, so it reads as zero too.
+func legacyGIFPaletteEntries(table []byte, frame *giffile.Frame) []int {
+	var entries []int
+	for idx := 0; idx < len(table)/3; idx++ {
+		if idx == frame.TransparentIndex() || extractFromColor(table[idx*3], table[idx*3+1], table[idx*3+2]) == 0x00 {
+			continue
+		}
+		entries = append(entries, idx)
+	}
+	return entries
+}
+
+// GIFCapacityBytes sums the capacity of every frame in the plan, in bytes
+func GIFCapacityBytes(plan []GifFrameCapacity) int {
+	var bits int
+	for _, frameCap := range plan {
+		bits += frameCap.Capacity
+	}
+	return bits / 8
+}
+
+// PadGIFPalettes grows every color table smaller than GifMaxColor up to GifMaxColor entries.
+// The new entries sit at indices no pixel uses, so they don't change how the GIF renders
+// but give the embedder a full palette to work with.
+func PadGIFPalettes(file *giffile.GIF) {
+	if file.GlobalTable != nil {
+		file.GlobalTable = padGIFTable(file.GlobalTable)
+	}
+	for _, frame := range file.Frames() {
+		if frame.LocalTable != nil {
+			frame.LocalTable = padGIFTable(frame.LocalTable)
+		}
+	}
+}
+
+func padGIFTable(table []byte) []byte {
+	colors := len(table) / 3
+	if colors == 0 || colors >= GifMaxColor {
+		return table
+	}
+	padded := make([]byte, len(table), GifMaxColor*3)
+	copy(padded, table)
+	for entry := colors; entry < GifMaxColor; entry++ {
+		src := (entry % colors) * 3
+		padded = append(padded, table[src], table[src+1], table[src+2])
+	}
+	return padded
+}
+
+// describeGIFCapacity lists the capacity of each frame for error messages
+func describeGIFCapacity(plan []GifFrameCapacity) string {
+	var frames []string
+	for _, frameCap := range plan {
+		frames = append(frames, fmt.Sprintf("frame %d: %d", frameCap.FrameIndex, frameCap.Capacity/8))
+	}
+	return strings.Join(frames, ", ")
+}
@@ -0,0 +1,348 @@
+package process
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	"github.com/bshore/steggo/pkg/giffile"
+)
+
+const testTransparent = 3
+
+// testPalette returns a palette of n opaque colors with testTransparent fully transparent
+func testPalette(r *rand.Rand, n int) color.Palette {
+	palette := make(color.Palette, n)
+	for i := range palette {
+		palette[i] = color.RGBA{byte(r.UintN(256)), byte(r.UintN(256)), byte(r.UintN(256)), 0xff}
+	}
+	palette[testTransparent] = color.RGBA{}
+	return palette
+}
+
+// makeTestGIF encodes a three frame GIF whose frames use only the first half of their palette,
+// transparent pixels included, either sharing a global color table or each with its own
+func makeTestGIF(t *testing.T, r *rand.Rand, disposal byte, global bool) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	shared := testPalette(r, 64)
+	for range 3 {
+		palette := shared
+		if !global {
+			palette = testPalette(r, 64)
+		}
+		frame := image.NewPaletted(image.Rect(0, 0, 16, 16), palette)
+		for i := range frame.Pix {
+			frame.Pix[i] = byte(r.UintN(32))
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+		g.Disposal = append(g.Disposal, disposal)
+	}
+	if global {
+		g.Config = image.Config{ColorModel: shared, Width: 16, Height: 16}
+		g.BackgroundIndex = 5
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, g)
+	if err != nil {
+		t.Fatalf("encode test GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFPaletteTransparencyAndDisposal(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	disposals := map[string]byte{
+		"none":       gif.DisposalNone,
+		"background": gif.DisposalBackground,
+		"previous":   gif.DisposalPrevious,
+	}
+	for disposalName, disposal := range disposals {
+		for _, global := range []bool{true, false} {
+			name := disposalName + " local"
+			if global {
+				name = disposalName + " global"
+			}
+			original := makeTestGIF(t, r, disposal, global)
+			file, err := giffile.Decode(bytes.NewReader(original))
+			if err != nil {
+				t.Fatalf("%s: decode: %v", name, err)
+			}
+			PadGIFPalettes(file)
+			before := make([][]byte, len(file.Frames()))
+			for i, frame := range file.Frames() {
+				before[i] = bytes.Clone(file.Table(frame))
+			}
+			plan, err := PlanGIFCapacity(file)
+			if err != nil {
+				t.Fatalf("%s: plan: %v", name, err)
+			}
+
+			// Fill the whole capacity, so every entry the embedder is willing to touch is touched
+			msg := randomBlob(r, GIFCapacityBytes(plan)-20)
+			header := NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+			msg = msg[:GIFCapacityBytes(plan)-len(header)]
+			header = NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+			err = EmbedMsgInGIF(FinalizeMessage(header, msg), file)
+			if err != nil {
+				t.Fatalf("%s: embed: %v", name, err)
+			}
+			var out bytes.Buffer
+			err = giffile.Encode(&out, file)
+			if err != nil {
+				t.Fatalf("%s: encode: %v", name, err)
+			}
+
+			embedded, err := giffile.Decode(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: decode embedded: %v", name, err)
+			}
+			_, extracted, err := ExtractMsgFromGIF(embedded)
+			if err != nil || !bytes.Equal(extracted, msg) {
+				t.Errorf("%s: message didn't round trip: %v", name, err)
+			}
+
+			for i, frame := range embedded.Frames() {
+				if frame.Disposal() != disposal || frame.TransparentIndex() != testTransparent {
+					t.Errorf("%s: frame %d lost its disposal or transparency", name, i)
+				}
+				table := embedded.Table(frame)
+				if !bytes.Equal(table[testTransparent*3:testTransparent*3+3], before[i][testTransparent*3:testTransparent*3+3]) {
+					t.Errorf("%s: frame %d transparent color was changed", name, i)
+				}
+				bg := embedded.BackgroundIndex() * 3
+				if global && disposal == gif.DisposalBackground && !bytes.Equal(table[bg:bg+3], before[i][bg:bg+3]) {
+					t.Errorf("%s: frame %d background color was changed", name, i)
+				}
+			}
+			compareGIFRendering(t, name, original, out.Bytes())
+		}
+	}
+}
+
+func TestGIFIndexRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(9, 10))
+	for _, global := range []bool{true, false} {
+		name := "local"
+		if global {
+			name = "global"
+		}
+		file, err := giffile.Decode(bytes.NewReader(makeTestGIF(t, r, gif.DisposalNone, global)))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		var before [][]byte
+		for _, frame := range file.Frames() {
+			indices, err := frame.Indices()
+			if err != nil {
+				t.Fatalf("%s: indices: %v", name, err)
+			}
+			before = append(before, bytes.Clone(indices))
+		}
+		capacity, err := GIFIndexCapacity(file)
+		if err != nil {
+			t.Fatalf("%s: capacity: %v", name, err)
+		}
+
+		msg := randomBlob(r, capacity/2)
+		header := NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+		err = EmbedMsgInGIFIndices(append(header, msg...), file)
+		if err != nil {
+			t.Fatalf("%s: embed: %v", name, err)
+		}
+		var out bytes.Buffer
+		err = giffile.Encode(&out, file)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", name, err)
+		}
+		embedded, err := giffile.Decode(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: decode embedded: %v", name, err)
+		}
+		_, extracted, err := ExtractMsgFromGIFIndices(embedded)
+		if err != nil || !bytes.Equal(extracted, msg) {
+			t.Errorf("%s: message didn't round trip: %v", name, err)
+		}
+
+		for i, frame := range embedded.Frames() {
+			indices, err := frame.Indices()
+			if err != nil {
+				t.Fatalf("%s: embedded indices: %v", name, err)
+			}
+			for j := range indices {
+				if (indices[j] == testTransparent) != (before[i][j] == testTransparent) {
+					t.Fatalf("%s: frame %d pixel %d changed transparency", name, i, j)
+				}
+			}
+		}
+	}
+}
+
+func TestGIFIndexLeavesMatchingFramesAlone(t *testing.T) {
+	r := rand.New(rand.NewPCG(13, 14))
+	// Short sub-blocks only survive when the frame is written back without re-compressing it
+	original := resplitGIFImageData(t, makeTestGIF(t, r, gif.DisposalNone, false), 16)
+	file, err := giffile.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Embed the bits the first frame already holds, so none of its pixels need to change
+	frame := file.Frames()[0]
+	indices, err := frame.Indices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, pos := gifLuminanceOrder(file.Table(frame), frame.TransparentIndex())
+	var data []byte
+	var current byte
+	var bitCount int
+	for _, idx := range indices {
+		if !gifIndexUsable(order, pos, idx) {
+			continue
+		}
+		current = current<<1 | byte(pos[idx]&1)
+		if bitCount++; bitCount == 8 {
+			data = append(data, current)
+			current, bitCount = 0, 0
+		}
+	}
+	err = EmbedMsgInGIFIndices(data, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = giffile.Encode(&out, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), original) {
+		t.Error("frame was re-compressed though none of its indices changed")
+	}
+}
+
+// resplitGIFImageData rewrites every frame's image data into sub-blocks of at most size bytes
+func resplitGIFImageData(t *testing.T, b []byte, size int) []byte {
+	t.Helper()
+	out := bytes.Clone(b[:13])
+	pos := 13
+	if b[10]&0x80 != 0 {
+		n := 3 << (b[10]&7 + 1)
+		out = append(out, b[pos:pos+n]...)
+		pos += n
+	}
+	subBlocks := func() []byte {
+		var data []byte
+		for b[pos] != 0 {
+			data = append(data, b[pos+1:pos+1+int(b[pos])]...)
+			pos += 1 + int(b[pos])
+		}
+		pos++
+		return data
+	}
+	for pos < len(b) {
+		switch b[pos] {
+		case 0x21:
+			start := pos
+			pos += 2
+			subBlocks()
+			out = append(out, b[start:pos]...)
+		case 0x2C:
+			start := pos
+			pos += 10
+			if b[start+9]&0x80 != 0 {
+				pos += 3 << (b[start+9]&7 + 1)
+			}
+			pos++ // LZW minimum code size
+			out = append(out, b[start:pos]...)
+			for data := subBlocks(); len(data) > 0; data = data[min(size, len(data)):] {
+				n := min(size, len(data))
+				out = append(append(out, byte(n)), data[:n]...)
+			}
+			out = append(out, 0)
+		case 0x3B:
+			return append(out, 0x3B)
+		default:
+			t.Fatalf("unexpected GIF block 0x%02x at %d", b[pos], pos)
+		}
+	}
+	return out
+}
+
+func TestGIFIndexRejectsOversizedMessage(t *testing.T) {
+	r := rand.New(rand.NewPCG(11, 12))
+	file, err := giffile.Decode(bytes.NewReader(makeTestGIF(t, r, gif.DisposalNone, true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	capacity, err := GIFIndexCapacity(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = EmbedMsgInGIFIndices(randomBlob(r, capacity+1), file)
+	if err == nil {
+		t.Fatalf("embedding %d bytes into %d bytes of capacity succeeded", capacity+1, capacity)
+	}
+}
+
+// compareGIFRendering checks that every pixel of the embedded GIF keeps its exact alpha and
+// only differs from the original in the bits a message byte is embedded into
+func compareGIFRendering(t *testing.T, name string, original, embedded []byte) {
+	t.Helper()
+	a, err := gif.DecodeAll(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("%s: stdlib decode original: %v", name, err)
+	}
+	b, err := gif.DecodeAll(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatalf("%s: stdlib decode embedded: %v", name, err)
+	}
+	if len(a.Image) != len(b.Image) || a.BackgroundIndex != b.BackgroundIndex {
+		t.Fatalf("%s: frame count or background index changed", name)
+	}
+	for i := range a.Image {
+		for p := range a.Image[i].Pix {
+			x, y := p%16, p/16
+			ca := color.NRGBAModel.Convert(a.Image[i].At(x, y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.Image[i].At(x, y)).(color.NRGBA)
+			if ca.A != cb.A {
+				t.Fatalf("%s: frame %d pixel %d alpha changed from %d to %d", name, i, p, ca.A, cb.A)
+			}
+			if ca.R>>3 != cb.R>>3 || ca.G>>3 != cb.G>>3 || ca.B>>3 != cb.B>>3 {
+				t.Fatalf("%s: frame %d pixel %d changed beyond its LSBs: %v to %v", name, i, p, ca, cb)
+			}
+		}
+	}
+}
+
+// The fixtures were embedded by the original GIF encoder, which skipped palette entries reading
+// as a zero byte: one with a shared palette holding transparent, black and background entries,
+// the other with local palettes and a b64 pre-encoded message
+func TestGIFLegacyLayout(t *testing.T) {
+	fixtures := map[string]string{
+		"testdata/legacy_global.gif": "legacy gif message, written by the baseline encoder",
+		"testdata/legacy_local.gif":  "bG9jYWwgcGFsZXR0ZXM=",
+	}
+	for path, want := range fixtures {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		file, err := giffile.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", path, err)
+		}
+		_, msg, err := ExtractMsgFromGIF(file)
+		if err != nil {
+			t.Errorf("%s: extract: %v", path, err)
+			continue
+		}
+		if string(msg) != want {
+			t.Errorf("%s: extracted %q, want %q", path, msg, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/bshore/steggo/pkg/giffile"
+)
+
+/*
+	This file contains the EzStego style embed/extract functions for GIF pixel indices.
+
+	Each frame's palette is sorted by luminance, and neighbouring colors in that order are
+	paired up (0-1, 2-3, ...). A pixel holds one bit in the parity of its color's position in
+	the sorted order, and embedding swaps it to the other color of its pair when the parity
+	doesn't match. The palette itself never changes, so extraction rebuilds the same order.
+	Capacity grows with the number of pixels instead of being capped by the palette size.
+*/
+
+// GIFIndexCapacity returns the number of header and message bytes the pixel indices can hold
+func GIFIndexCapacity(file *giffile.GIF) (int, error) {
+	var bits int
+	for frameIdx, frame := range file.Frames() {
+		indices, err := frame.Indices()
+		if err != nil {
+			return 0, fmt.Errorf("error reading frame %d: %v", frameIdx, err)
+		}
+		order, pos := gifLuminanceOrder(file.Table(frame), frame.TransparentIndex())
+		for _, idx := range indices {
+			if gifIndexUsable(order, pos, idx) {
+				bits++
+			}
+		}
+	}
+	return bits / 8, nil
+}
+
+// EmbedMsgInGIFIndices embeds the header and message bits into the parity of each pixel's
+// position in its frame's luminance sorted palette
+func EmbedMsgInGIFIndices(data []byte, file *giffile.GIF) error {
+	capacity, err := GIFIndexCapacity(file)
+	if err != nil {
+		return err
+	}
+	if len(data) > capacity {
+		return fmt.Errorf("message won't fit: %d bytes to embed, %d bytes available", len(data), capacity)
+	}
+	bitsIndex := 0
+	for frameIdx, frame := range file.Frames() {
+		if bitsIndex >= len(data)*8 {
+			break
+		}
+		indices, err := frame.Indices()
+		if err != nil {
+			return fmt.Errorf("error reading frame %d: %v", frameIdx, err)
+		}
+		indices = bytes.Clone(indices)
+		order, pos := gifLuminanceOrder(file.Table(frame), frame.TransparentIndex())
+		var changed bool
+		for i, idx := range indices {
+			if bitsIndex >= len(data)*8 {
+				break
+			}
+			if !gifIndexUsable(order, pos, idx) {
+				continue
+			}
+			if byte(pos[idx]&1) != bitAt(data, bitsIndex) {
+				indices[i] = uint8(order[pos[idx]^1])
+				changed = true
+			}
+			bitsIndex++
+		}
+		// Frames whose bits already matched keep their original compressed data
+		if changed {
+			frame.SetIndices(indices)
+		}
+	}
+	return nil
+}
+
+// ExtractMsgFromGIFIndices reads the bits back from the pixel indices until the header's
+// message size has been read
+func ExtractMsgFromGIFIndices(file *giffile.GIF) (*Header, []byte, error) {
+	var headBytes, msgBytes []byte
+	var headerFound bool
+	var header = &Header{}
+
+	var current byte
+	var bitCount int
+	for frameIdx, frame := range file.Frames() {
+		indices, err := frame.Indices()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading frame %d: %v", frameIdx, err)
+		}
+		order, pos := gifLuminanceOrder(file.Table(frame), frame.TransparentIndex())
+		for _, idx := range indices {
+			if !gifIndexUsable(order, pos, idx) {
+				continue
+			}
+			current = current<<1 | byte(pos[idx]&1)
+			bitCount++
+			if bitCount < 8 {
+				continue
+			}
+			if headerFound {
+				msgBytes = append(msgBytes, current)
+			} else {
+				headBytes = append(headBytes, current)
+				headerFound = header.Found(headBytes)
+			}
+			current, bitCount = 0, 0
+			if headerFound && len(msgBytes) >= header.Size {
+				return header, msgBytes, nil
+			}
+		}
+	}
+
+	if !headerFound {
+		return nil, nil, fmt.Errorf("failed to extract message, header not found")
+	}
+	return nil, nil, fmt.Errorf("failed to extract complete message: got %d bytes, expected %d", len(msgBytes), header.Size)
+}
+
+// gifLuminanceOrder sorts the color table indices by luminance, leaving out the transparent
+// index. order lists the table indices in sorted order and pos maps a table index back to its
+// position in order, or -1 when it isn't part of it.
+func gifLuminanceOrder(table []byte, transparent int) (order []int, pos [GifMaxColor]int) {
+	for i := range pos {
+		pos[i] = -1
+	}
+	colors := min(len(table)/3, GifMaxColor)
+	lum := make([]int, colors)
+	for i := 0; i < colors; i++ {
+		if i == transparent {
+			continue
+		}
+		lum[i] = 299*int(table[i*3]) + 587*int(table[i*3+1]) + 114*int(table[i*3+2])
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lum[order[i]] < lum[order[j]]
+	})
+	for i, idx := range order {
+		pos[idx] = i
+	}
+	return order, pos
+}
+
+// gifIndexUsable reports whether a pixel with the palette index can hold a bit: its color
+// must be in the luminance order and have a partner to swap with
+func gifIndexUsable(order []int, pos [GifMaxColor]int, idx uint8) bool {
+	return pos[idx] >= 0 && pos[idx]^1 < len(order)
+}
@@ -1,7 +1,10 @@
 package process
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
@@ -13,16 +16,65 @@ type Header struct {
 	Size        int
 	SrcType     string
 	PreEncoding string
+	// Name is the input file's base name without its extension, empty for text input
+	Name string
+	// Mode holds the input file's permission bits, zero when unknown
+	Mode os.FileMode
+	// Shard is set when the message is one piece of a message split across several carriers
+	Shard *Shard
+	// Length is the number of bytes the header itself takes up in the carrier
+	Length int
+	// Meta holds the optional creation time, expiry, sender, content type and tags
+	Meta Metadata
+}
+
+// Shard identifies one piece of a message split across several carriers
+type Shard struct {
+	// Set is a random ID shared by every shard of the message
+	Set   string
+	Index int
+	Total int
+	// Checksum is the CRC-32 of the whole message, or of the share itself for secret shares
+	Checksum uint32
+	// Threshold is the number of secret shares needed to recover the message, zero when
+	// the message is split into pieces instead
+	Threshold int
 }
 
 // Found checks if bytes has the header string termination characters !/
 func (h *Header) Found(b []byte) bool {
-	if strings.HasSuffix(string(b), "!/") {
+	if bytes.HasSuffix(b, []byte("!/")) {
 		headerPieces := strings.Split(strings.TrimSuffix(string(b), "!/"), ",")
-		size, _ := strconv.ParseInt(headerPieces[0], 10, 64)
+		if len(headerPieces) < 3 {
+			return false
+		}
+		size, err := strconv.ParseInt(headerPieces[0], 10, 64)
+		if err != nil || size < 0 {
+			// Not a real header, just LSBs that happen to end in !/
+			return false
+		}
 		h.Size = int(size)
 		h.SrcType = headerPieces[1]
 		h.PreEncoding = headerPieces[2]
+		h.Name, h.Mode, h.Shard, h.Meta = "", 0, nil, Metadata{}
+		h.Length = len(b)
+		if len(headerPieces) >= 5 {
+			name, err := base64.RawURLEncoding.DecodeString(headerPieces[3])
+			if err == nil {
+				h.Name = string(name)
+			}
+			mode, err := strconv.ParseUint(headerPieces[4], 8, 32)
+			if err == nil {
+				h.Mode = os.FileMode(mode).Perm()
+			}
+		}
+		if len(headerPieces) > 5 {
+			var rest []string
+			h.Meta, rest = splitMetadata(headerPieces[5:])
+			if len(rest) >= 4 {
+				h.Shard = parseShard(rest)
+			}
+		}
 		return true
 	}
 	return false
@@ -36,19 +88,88 @@ func (h *Header) Found(b []byte) bool {
 //   - 1024 indicates that the embedded message has a length of 1024 characters
 //   - 0 indicates that the source type was a png
 //   - 1/2!/ indicates that the message was pre-encoded with b16 and b32 before embed
-func NewHeaderBytes(input []byte, srcType string, encoders []encoders.EncType) []byte {
+//
+// Encoders that need a parameter record it base64 encoded after their ID, e.g. 14:MDEyMzQ1Njc
+// for base-N with the alphabet 01234567.
+//
+// When the input was a file, its name and permissions follow the pre-encoding:
+// - "1024,.pdf,1/2,cmVwb3J0,644!/"
+//   - cmVwb3J0 is the base name "report", base64 encoded so it can't contain a , or !/
+//   - 644 is the file mode in octal
+func NewHeaderBytes(input []byte, srcType, name string, mode os.FileMode, preEncoders []encoders.Encoder, meta Metadata) []byte {
+	return newHeaderBytes(input, srcType, name, mode, preEncoders, meta, nil)
+}
+
+// NewShardHeaderBytes returns the header for one shard of a message split across several
+// carriers. srcType, name, mode and preEncoders describe the whole message, while the size
+// is the shard's own. The shard follows the name and mode, which are written even when empty:
+// - "512,.pdf,1/2,cmVwb3J0,644,9f86d081884c7d65,0,2,3610a686!/"
+//   - 9f86d081884c7d65 is the set ID shared by every shard
+//   - 0,2 is the first shard of 2
+//   - 3610a686 is the CRC-32 of the whole message in hex
+//
+// Secret shares add the threshold needed to recover the message, e.g. ...,0,5,8c1f02d4,3!/
+//
+// Metadata (see metadata.go) comes last as key=value pieces, also writing the name and mode
+// when they're empty, e.g. "1024,txt,,,0,s=YWxpY2U,x=1761475200!/"
+func NewShardHeaderBytes(input []byte, srcType, name string, mode os.FileMode, preEncoders []encoders.Encoder, meta Metadata, shard Shard) []byte {
+	return newHeaderBytes(input, srcType, name, mode, preEncoders, meta, &shard)
+}
+
+// CheckSrcType returns an error when the input's extension can't be written into the header
+// as it is, since , separates the header's pieces and !/ ends the header
+func CheckSrcType(srcType string) error {
+	if strings.Contains(srcType, ",") || strings.Contains(srcType, "!/") {
+		return fmt.Errorf("input file extension %q can't contain , or !/, rename the file first", srcType)
+	}
+	return nil
+}
+
+func newHeaderBytes(input []byte, srcType, name string, mode os.FileMode, preEncoders []encoders.Encoder, meta Metadata, shard *Shard) []byte {
 	// Build pre-encoding string
-	var preEncodingStr string
-	if len(encoders) == 0 {
-		preEncodingStr = "!/"
-	} else {
-		var encStrs []string
-		for i := range encoders {
-			encStrs = append(encStrs, encoders[i].String())
+	var encStrs []string
+	for i := range preEncoders {
+		encStrs = append(encStrs, encoders.HeaderCode(preEncoders[i]))
+	}
+	preEncodingStr := strings.Join(encStrs, "/")
+	if name != "" || shard != nil || !meta.IsZero() {
+		preEncodingStr += fmt.Sprintf(",%s,%o", base64.RawURLEncoding.EncodeToString([]byte(name)), mode.Perm())
+	}
+	if shard != nil {
+		preEncodingStr += fmt.Sprintf(",%s,%d,%d,%08x", shard.Set, shard.Index, shard.Total, shard.Checksum)
+		if shard.Threshold > 0 {
+			preEncodingStr += fmt.Sprintf(",%d", shard.Threshold)
+		}
+	}
+	for _, piece := range meta.pieces() {
+		preEncodingStr += "," + piece
+	}
+	return fmt.Appendf([]byte{}, "%d,%s,%s!/", len(input), srcType, preEncodingStr)
+}
+
+// parseShard reads the set, index, total, checksum and optional threshold pieces of a shard
+// header, returning nil when they don't describe a valid shard
+func parseShard(pieces []string) *Shard {
+	index, err := strconv.Atoi(pieces[1])
+	if err != nil {
+		return nil
+	}
+	total, err := strconv.Atoi(pieces[2])
+	if err != nil || index < 0 || index >= total || total > MaxShards {
+		return nil
+	}
+	checksum, err := strconv.ParseUint(pieces[3], 16, 32)
+	if err != nil {
+		return nil
+	}
+	shard := &Shard{Set: pieces[0], Index: index, Total: total, Checksum: uint32(checksum)}
+	if len(pieces) >= 5 {
+		shard.Threshold, err = strconv.Atoi(pieces[4])
+		if err != nil || shard.Threshold < 1 || shard.Threshold > total {
+			return nil
 		}
-		preEncodingStr = fmt.Sprintf("%s!/", strings.Join(encStrs, "/"))
 	}
-	return fmt.Appendf([]byte{}, "%d,%s,%s", len(input), srcType, preEncodingStr)
+	return shard
 }
 
 // FinalizeMessage transforms the header and message into it's final form for R,G,B least significant bit insertion
@@ -0,0 +1,219 @@
+package process
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	mrand "math/rand/v2"
+)
+
+/*
+	This file contains the deniable layers, several messages embedded in one image
+	under different passphrases.
+
+	The pixels are split into LayerSlots slots by their index, so no two layers ever
+	share a pixel. Each layer goes into a random slot, in an order shuffled by a key
+	derived from its passphrase, and is sealed with AES-GCM under that key. Slots
+	without a layer are filled with noise, so every slot looks alike and a passphrase
+	only ever reveals its own layer. Extraction tries each slot with the key and keeps
+	the one that opens.
+*/
+
+// LayerSlots is the number of slots the pixels are split into, the most layers an image can hold
+const LayerSlots = 4
+
+// layerKDFIterations is the PBKDF2 iteration count used to derive a layer's key
+const layerKDFIterations = 100000
+
+// layerSalt is fixed, since extraction only has the passphrase to go on
+var layerSalt = []byte("steggo layer")
+
+// Layer is one passphrase's header and message
+type Layer struct {
+	Passphrase string
+	Header     []byte
+	Msg        []byte
+}
+
+// layerKey derives the cipher that seals a layer, and the seed that orders its pixels
+func layerKey(passphrase string) (cipher.AEAD, [32]byte, error) {
+	var seed [32]byte
+	key, err := pbkdf2.Key(sha256.New, passphrase, layerSalt, layerKDFIterations, 64)
+	if err != nil {
+		return nil, seed, fmt.Errorf("failed to derive layer key: %v", err)
+	}
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, seed, fmt.Errorf("failed to create layer cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, seed, fmt.Errorf("failed to create layer cipher: %v", err)
+	}
+	copy(seed[:], key[32:])
+	return aead, seed, nil
+}
+
+// layerPositions returns the pixel indices of a slot, shuffled by the layer's seed
+func layerPositions(pixels, slot int, seed [32]byte) []int {
+	var positions []int
+	for p := slot; p < pixels; p += LayerSlots {
+		positions = append(positions, p)
+	}
+	mrand.New(mrand.NewChaCha8(seed)).Shuffle(len(positions), func(i, j int) {
+		positions[i], positions[j] = positions[j], positions[i]
+	})
+	return positions
+}
+
+// LayerCapacity returns the number of header and message bytes each layer of the image can hold
+func LayerCapacity(file image.Image) int {
+	pixels := file.Bounds().Dx() * file.Bounds().Dy()
+	// The last slot is the smallest when the pixels don't split evenly, and every layer
+	// gives up 12 bytes to its GCM nonce and 16 to its authentication tag
+	return max(pixels/LayerSlots-12-16, 0)
+}
+
+// EmbedLayers embeds each layer into its own slot of the image's pixels, filling the
+// slots left over with noise
+func EmbedLayers(layers []Layer, file image.Image, noise io.Reader) (draw.Image, error) {
+	if len(layers) > LayerSlots {
+		return nil, fmt.Errorf("too many layers: %d given, an image holds up to %d", len(layers), LayerSlots)
+	}
+	seen := map[string]bool{}
+	for _, layer := range layers {
+		if seen[layer.Passphrase] {
+			return nil, fmt.Errorf("every layer needs a different passphrase")
+		}
+		seen[layer.Passphrase] = true
+	}
+
+	bounds := file.Bounds()
+	width := bounds.Dx()
+	pixels := width * bounds.Dy()
+	newFile := image.NewNRGBA64(image.Rect(0, 0, width, bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := nrgba64At(file, x, y)
+			newFile.SetNRGBA64(x-bounds.Min.X, y-bounds.Min.Y, color.NRGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: uint16(a)})
+		}
+	}
+
+	// Pick a random slot for each layer, so the slot doesn't give away the order they were given in
+	var slotSeed [32]byte
+	_, err := io.ReadFull(noise, slotSeed[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate noise: %v", err)
+	}
+	slots := mrand.New(mrand.NewChaCha8(slotSeed)).Perm(LayerSlots)
+
+	for slot := 0; slot < LayerSlots; slot++ {
+		var positions []int
+		var payload []byte
+		layer := -1
+		for i := range layers {
+			if slots[i] == slot {
+				layer = i
+			}
+		}
+		if layer < 0 {
+			positions = layerPositions(pixels, slot, slotSeed)
+			payload = make([]byte, len(positions))
+			_, err = io.ReadFull(noise, payload)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate noise: %v", err)
+			}
+		} else {
+			aead, seed, err := layerKey(layers[layer].Passphrase)
+			if err != nil {
+				return nil, err
+			}
+			positions = layerPositions(pixels, slot, seed)
+			payload, err = sealLayer(layers[layer], aead, len(positions), noise)
+			if err != nil {
+				return nil, fmt.Errorf("layer %d: %v", layer+1, err)
+			}
+		}
+		for i, p := range positions {
+			x, y := p%width, p/width
+			c := newFile.NRGBA64At(x, y)
+			data := FinalizeMessage(nil, []byte{payload[i]})
+			c.R = embedIn16BitColor(data[0], uint32(c.R))
+			c.G = embedIn16BitColor(data[1], uint32(c.G))
+			c.B = embedIn16BitColor(data[2], uint32(c.B))
+			newFile.SetNRGBA64(x, y, c)
+		}
+	}
+	return newFile, nil
+}
+
+// sealLayer pads the layer's header and message with noise to fill size bytes once
+// sealed, and seals it behind a random nonce
+func sealLayer(layer Layer, aead cipher.AEAD, size int, noise io.Reader) ([]byte, error) {
+	capacity := size - aead.NonceSize() - aead.Overhead()
+	if len(layer.Header)+len(layer.Msg) > capacity {
+		return nil, fmt.Errorf("message won't fit in layer: %d bytes to embed, %d bytes available", len(layer.Header)+len(layer.Msg), capacity)
+	}
+	plain := make([]byte, capacity)
+	n := copy(plain, layer.Header)
+	n += copy(plain[n:], layer.Msg)
+	_, err := io.ReadFull(noise, plain[n:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate noise: %v", err)
+	}
+	// The nonce always comes from crypto/rand, never the noise source, which can be keyed
+	// and would then repeat the nonce under the same passphrase
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// ExtractLayer reads back the layer belonging to the passphrase, trying each slot
+// until one opens with its key
+func ExtractLayer(file image.Image, passphrase string) (*Header, []byte, error) {
+	aead, seed, err := layerKey(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	bounds := file.Bounds()
+	width := bounds.Dx()
+	pixels := width * bounds.Dy()
+	for slot := 0; slot < LayerSlots; slot++ {
+		positions := layerPositions(pixels, slot, seed)
+		if len(positions) < aead.NonceSize()+aead.Overhead() {
+			continue
+		}
+		sealed := make([]byte, len(positions))
+		for i, p := range positions {
+			r, g, b, _ := nrgba64At(file, bounds.Min.X+p%width, bounds.Min.Y+p/width)
+			sealed[i] = extractFromColor(uint8(r), uint8(g), uint8(b))
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		plain, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			// Not this passphrase's slot
+			continue
+		}
+		header := &Header{}
+		for i := 1; i <= len(plain); i++ {
+			if header.Found(plain[:i]) {
+				if header.Size > len(plain)-i {
+					return nil, nil, fmt.Errorf("layer is truncated: %d bytes expected, %d bytes available", header.Size, len(plain)-i)
+				}
+				return header, plain[i : i+header.Size], nil
+			}
+		}
+		return nil, nil, fmt.Errorf("layer has no header")
+	}
+	return nil, nil, fmt.Errorf("no layer found for the passphrase")
+}
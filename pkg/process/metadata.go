@@ -0,0 +1,108 @@
+package process
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	This file contains the optional metadata carried in the header.
+
+	Every field is a key=value piece after the name and mode, and is only written when
+	it's set, so a message without metadata keeps the plain header. Times are Unix
+	seconds, and everything else is base64 encoded so it can't contain a , or !/.
+	- c=1760870400     the time the message was created
+	- x=1761475200     the time the message expires
+	- s=YWxpY2U        the sender label
+	- t=YXBwbGljYXRpb24vcGRm   the content type
+	- g=cHJvamVjdA:YXBvbGxv   a key:value tag, repeated for each tag
+*/
+
+// Metadata holds the optional provenance fields of a message
+type Metadata struct {
+	Created     time.Time
+	Expires     time.Time
+	Sender      string
+	ContentType string
+	// Tags are free-form key/value pairs, kept in the order they were given
+	Tags [][2]string
+}
+
+// IsZero reports whether no metadata field is set
+func (m Metadata) IsZero() bool {
+	return m.Created.IsZero() && m.Expires.IsZero() && m.Sender == "" && m.ContentType == "" && len(m.Tags) == 0
+}
+
+// Expired reports whether the message has an expiry time that has passed by now
+func (m Metadata) Expired(now time.Time) bool {
+	return !m.Expires.IsZero() && now.After(m.Expires)
+}
+
+// pieces returns the header pieces of the metadata fields that are set
+func (m Metadata) pieces() []string {
+	var pieces []string
+	if !m.Created.IsZero() {
+		pieces = append(pieces, "c="+strconv.FormatInt(m.Created.Unix(), 10))
+	}
+	if !m.Expires.IsZero() {
+		pieces = append(pieces, "x="+strconv.FormatInt(m.Expires.Unix(), 10))
+	}
+	if m.Sender != "" {
+		pieces = append(pieces, "s="+encodeMetaValue(m.Sender))
+	}
+	if m.ContentType != "" {
+		pieces = append(pieces, "t="+encodeMetaValue(m.ContentType))
+	}
+	for _, tag := range m.Tags {
+		pieces = append(pieces, "g="+encodeMetaValue(tag[0])+":"+encodeMetaValue(tag[1]))
+	}
+	return pieces
+}
+
+// splitMetadata separates the metadata pieces from the rest of the header pieces.
+// Pieces that can't be read are skipped, so a damaged field doesn't lose the message.
+func splitMetadata(pieces []string) (Metadata, []string) {
+	var meta Metadata
+	var rest []string
+	for _, piece := range pieces {
+		key, value, ok := strings.Cut(piece, "=")
+		if !ok {
+			rest = append(rest, piece)
+			continue
+		}
+		switch key {
+		case "c", "x":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			if key == "c" {
+				meta.Created = time.Unix(seconds, 0)
+			} else {
+				meta.Expires = time.Unix(seconds, 0)
+			}
+		case "s":
+			meta.Sender = decodeMetaValue(value)
+		case "t":
+			meta.ContentType = decodeMetaValue(value)
+		case "g":
+			tagKey, tagValue, _ := strings.Cut(value, ":")
+			meta.Tags = append(meta.Tags, [2]string{decodeMetaValue(tagKey), decodeMetaValue(tagValue)})
+		}
+	}
+	return meta, rest
+}
+
+func encodeMetaValue(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeMetaValue(s string) string {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,145 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/bshore/steggo/pkg/midi"
+)
+
+/*
+	This file contains the embed/extract functions for MIDI files.
+
+	Each note-on event holds one bit of the header and message in the least significant bit
+	of its velocity, in track order. When jitter is allowed, the delta-times of note-on events
+	hold further bits once every velocity is used. Velocities always come first so extraction
+	can walk the same order without knowing whether jitter was used.
+*/
+
+// MIDICapacity returns the number of header and message bytes the file can hold
+func MIDICapacity(file *midi.File, jitter bool) int {
+	bits := len(midiVelocityEvents(file))
+	if jitter {
+		bits += len(midiDeltaEvents(file))
+	}
+	return bits / 8
+}
+
+// EmbedMsgInMIDI embeds the header and message bits into note-on velocities, followed
+// by note-on delta-times when jitter is set
+func EmbedMsgInMIDI(data []byte, file *midi.File, jitter bool) error {
+	capacity := MIDICapacity(file, jitter)
+	if len(data) > capacity {
+		return fmt.Errorf("message won't fit in MIDI file: %d bytes to embed, %d bytes available", len(data), capacity)
+	}
+	velocities := midiVelocityEvents(file)
+	var deltas []*midi.Event
+	trackOf := map[*midi.Event]int{}
+	if jitter {
+		deltas = midiDeltaEvents(file)
+		for i, track := range file.Tracks() {
+			for _, e := range track.Events {
+				trackOf[e] = i
+			}
+		}
+	}
+
+	// drift tracks how far the delta-times have moved the following events of each track,
+	// so that every change is balanced out by the next one in the same track instead of
+	// piling up. Tracks play side by side, so one track's drift can't make up for another's.
+	drift := map[int]int{}
+	for i := 0; i < len(data)*8; i++ {
+		bit := bitAt(data, i)
+		if i < len(velocities) {
+			e := velocities[i]
+			v := e.Velocity()&^1 | bit
+			if v == 0 {
+				// A velocity of zero would turn the note-on into a note-off
+				v = 2
+			}
+			e.SetVelocity(v)
+			continue
+		}
+		e := deltas[i-len(velocities)]
+		if e.Delta&1 == uint32(bit) {
+			continue
+		}
+		track := trackOf[e]
+		if drift[track] <= 0 || e.Delta-1 < 2 {
+			e.Delta++
+			drift[track]++
+		} else {
+			e.Delta--
+			drift[track]--
+		}
+	}
+	return nil
+}
+
+// ExtractMsgFromMIDI reads bits back from velocities and then delta-times until the
+// header's message size has been read
+func ExtractMsgFromMIDI(file *midi.File) (*Header, []byte, error) {
+	var headBytes, msgBytes []byte
+	var headerFound bool
+	var header = &Header{}
+
+	var current byte
+	var bitCount int
+	read := func(bit byte) bool {
+		current = current<<1 | bit
+		bitCount++
+		if bitCount < 8 {
+			return false
+		}
+		b := current
+		current, bitCount = 0, 0
+		if headerFound {
+			msgBytes = append(msgBytes, b)
+			return len(msgBytes) >= header.Size
+		}
+		headBytes = append(headBytes, b)
+		headerFound = header.Found(headBytes)
+		return headerFound && header.Size == 0
+	}
+
+	for _, e := range midiVelocityEvents(file) {
+		if read(e.Velocity() & 1) {
+			return header, msgBytes, nil
+		}
+	}
+	for _, e := range midiDeltaEvents(file) {
+		if read(byte(e.Delta & 1)) {
+			return header, msgBytes, nil
+		}
+	}
+
+	if !headerFound {
+		return nil, nil, fmt.Errorf("failed to extract message, header not found")
+	}
+	return nil, nil, fmt.Errorf("failed to extract complete message: got %d bytes, expected %d", len(msgBytes), header.Size)
+}
+
+// midiVelocityEvents returns every note-on event in track order
+func midiVelocityEvents(file *midi.File) []*midi.Event {
+	var events []*midi.Event
+	for _, track := range file.Tracks() {
+		for _, e := range track.Events {
+			if e.IsNoteOn() {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
+
+// midiDeltaEvents returns every note-on event whose delta-time can change by one tick
+// without becoming zero (which would merge it with the previous event). Embedding only
+// ever moves these delta-times within 2 and up, so extraction finds the same events.
+func midiDeltaEvents(file *midi.File) []*midi.Event {
+	var events []*midi.Event
+	for _, e := range midiVelocityEvents(file) {
+		if e.Delta >= 2 {
+			events = append(events, e)
+		}
+	}
+	return events
+}
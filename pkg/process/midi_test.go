@@ -0,0 +1,95 @@
+package process
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/bshore/steggo/pkg/midi"
+)
+
+// testMIDI returns a type 1 MIDI file with one track per delta-time, each holding n note-ons
+// spaced by that many ticks
+func testMIDI(t *testing.T, n int, deltas ...byte) *midi.File {
+	var b bytes.Buffer
+	b.Write([]byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, byte(len(deltas)), 0, 96})
+	for _, delta := range deltas {
+		var track []byte
+		for range n {
+			track = append(track, delta, 0x90, 60, 64)
+		}
+		track = append(track, 0, 0xFF, 0x2F, 0)
+		b.Write([]byte{'M', 'T', 'r', 'k', 0, 0, byte(len(track) >> 8), byte(len(track))})
+		b.Write(track)
+	}
+	file, err := midi.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func trackTicks(track *midi.Chunk) int {
+	var ticks int
+	for _, e := range track.Events {
+		ticks += int(e.Delta)
+	}
+	return ticks
+}
+
+func TestMIDIJitterDriftIsPerTrack(t *testing.T) {
+	// Every delta-time of the first track is at the lowest it can go, so each change to it adds
+	// a tick, which mustn't be taken back out of the second track
+	file := testMIDI(t, 32, 2, 10)
+	before := make([]int, len(file.Tracks()))
+	for i, track := range file.Tracks() {
+		before[i] = trackTicks(track)
+	}
+	data := bytes.Repeat([]byte{0xFF}, MIDICapacity(file, true))
+	err := EmbedMsgInMIDI(data, file, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift := trackTicks(file.Tracks()[1]) - before[1]; drift < -1 || drift > 1 {
+		t.Errorf("second track drifted by %d ticks", drift)
+	}
+	for _, e := range midiDeltaEvents(file) {
+		if e.Delta&1 != 1 {
+			t.Fatalf("delta-time %d doesn't hold its bit", e.Delta)
+		}
+	}
+}
+
+func TestMIDIRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(15, 16))
+	for _, jitter := range []bool{false, true} {
+		name := "velocity"
+		if jitter {
+			name = "jitter"
+		}
+		file := testMIDI(t, 128, 3, 7)
+		capacity := MIDICapacity(file, jitter)
+		// Fill the capacity, so jitter mode spills into the delta-times
+		msg := randomBlob(r, capacity)
+		header := NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+		msg = msg[:capacity-len(header)]
+		header = NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+		err := EmbedMsgInMIDI(append(header, msg...), file, jitter)
+		if err != nil {
+			t.Fatalf("%s: embed: %v", name, err)
+		}
+		var out bytes.Buffer
+		err = midi.Encode(&out, file)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", name, err)
+		}
+		embedded, err := midi.Decode(&out)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		_, extracted, err := ExtractMsgFromMIDI(embedded)
+		if err != nil || !bytes.Equal(extracted, msg) {
+			t.Errorf("%s: message didn't round trip: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package process
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"strconv"
+)
+
+/*
+	This file contains the padding and noise used to hide how long the message is.
+
+	Both are extra bytes embedded after the message. The header records the message's
+	own size, so extraction stops before reaching them. Padding rounds the payload up
+	to a size bucket, and noise fills whatever capacity is left, so the LSBs of the whole
+	carrier look alike instead of changing character where the message ends.
+*/
+
+// PadPow2 pads the payload up to the next power of two
+const PadPow2 = "pow2"
+
+// NewNoise returns the source of padding and noise bytes. With a key it's a ChaCha8
+// stream derived from the key, so the same key reproduces the same carrier, otherwise
+// it's crypto/rand.
+func NewNoise(key string) io.Reader {
+	if key == "" {
+		return rand.Reader
+	}
+	return mrand.NewChaCha8(sha256.Sum256([]byte("steggo noise:" + key)))
+}
+
+// PaddedSize returns the size the bucket rounds a payload of size bytes up to. The
+// bucket is either pow2 or a fixed size in bytes.
+func PaddedSize(size int, bucket string) (int, error) {
+	if bucket == PadPow2 {
+		padded := 1
+		for padded < size {
+			padded <<= 1
+		}
+		return padded, nil
+	}
+	fixed, err := strconv.Atoi(bucket)
+	if err != nil || fixed <= 0 {
+		return 0, fmt.Errorf("invalid padding bucket %q, expected %s or a size in bytes", bucket, PadPow2)
+	}
+	if size > fixed {
+		return 0, fmt.Errorf("payload of %d bytes is larger than the padding bucket of %d bytes", size, fixed)
+	}
+	return fixed, nil
+}
+
+// Pad appends noise to msg so the header and message together fill the padding bucket
+func Pad(header, msg []byte, bucket string, noise io.Reader) ([]byte, error) {
+	size, err := PaddedSize(len(header)+len(msg), bucket)
+	if err != nil {
+		return nil, err
+	}
+	padding := make([]byte, size-len(header)-len(msg))
+	_, err = io.ReadFull(noise, padding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate padding: %v", err)
+	}
+	return append(append([]byte{}, msg...), padding...), nil
+}
+
+// FillWithNoise appends finalized noise to the finalized message data until it holds
+// capacity bytes, the way the carrier's capacity is counted
+func FillWithNoise(data []byte, capacity int, noise io.Reader) ([]byte, error) {
+	remaining := capacity - len(data)/3
+	if remaining <= 0 {
+		return data, nil
+	}
+	filler := make([]byte, remaining)
+	_, err := io.ReadFull(noise, filler)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate noise: %v", err)
+	}
+	return append(data, FinalizeMessage(nil, filler)...), nil
+}
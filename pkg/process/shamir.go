@@ -0,0 +1,97 @@
+package process
+
+import (
+	"fmt"
+	"io"
+)
+
+/*
+	This file contains Shamir's secret sharing over GF(256).
+
+	Every byte of the secret is the constant term of its own random polynomial of degree
+	k-1, and share i holds each polynomial evaluated at x = i+1. Any k shares pin down the
+	polynomials and so the secret, while k-1 or fewer say nothing about it. The field uses
+	the AES polynomial x^8 + x^4 + x^3 + x + 1, with multiplication done through log tables
+	of the generator 3.
+*/
+
+var gfExp [510]byte
+var gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		// Multiply by the generator 3, x*2 ^ x, reducing by the field polynomial
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// SplitSecret splits the secret into n shares, any threshold of which recover it.
+// Share i is meant for x = i+1.
+func SplitSecret(secret []byte, n, threshold int, random io.Reader) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > MaxShards {
+		return nil, fmt.Errorf("invalid sharing scheme %d of %d, expected 2 <= threshold <= shares <= %d", threshold, n, MaxShards)
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+	coefficients := make([]byte, threshold-1)
+	for pos, b := range secret {
+		_, err := io.ReadFull(random, coefficients)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate share coefficients: %v", err)
+		}
+		for i := range shares {
+			x := byte(i + 1)
+			// Horner's method, from the highest coefficient down to the secret byte
+			var y byte
+			for c := len(coefficients) - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+			shares[i][pos] = gfMul(y, x) ^ b
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares recovers the secret from shares taken at the x coordinates xs, using
+// Lagrange interpolation at x = 0. Every share must be the same length.
+func CombineShares(xs []byte, shares [][]byte) []byte {
+	secret := make([]byte, len(shares[0]))
+	for i, xi := range xs {
+		// The Lagrange basis polynomial for xi evaluated at 0
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(xj, xj^xi))
+			}
+		}
+		for pos := range secret {
+			secret[pos] ^= gfMul(shares[i][pos], basis)
+		}
+	}
+	return secret
+}
@@ -0,0 +1,128 @@
+package process
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"slices"
+)
+
+/*
+	This file contains the shards of a message split across several carriers.
+
+	Each carrier holds a normal header and message, with the header also naming the set
+	the shard belongs to, its index, how many shards there are and the checksum of the
+	whole message. Extraction gathers the shards in any order, puts them back in index
+	order and checks the result against the checksum.
+
+	Secret shares (see shamir.go) hold the whole message, header included, split so that
+	any threshold of them recover it. The header a share is embedded with only describes
+	the share, so no single carrier gives away the message's name, type or size.
+*/
+
+// MaxShards is the most carriers a message can be split across, which is also the most
+// secret shares GF(256) has room for
+const MaxShards = 255
+
+// NewShardSet returns a random set ID for the shards of a message
+func NewShardSet() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate shard set ID: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// ShardChecksum returns the checksum recorded in every shard header of the message
+func ShardChecksum(msg []byte) uint32 {
+	return crc32.ChecksumIEEE(msg)
+}
+
+// JoinShards reassembles a message from its shards, given in any order. Every shard of
+// the set must be there, and the joined message must match the set's checksum. Secret
+// shares only need the set's threshold of them.
+func JoinShards(headers []*Header, pieces [][]byte) (*Header, []byte, error) {
+	if len(headers) == 0 {
+		return nil, nil, fmt.Errorf("no shards to join")
+	}
+	first := headers[0].Shard
+	if first == nil {
+		return nil, nil, fmt.Errorf("message is not a shard")
+	}
+	if len(headers) > first.Total {
+		return nil, nil, fmt.Errorf("%d targets given, but the set only has %d shards", len(headers), first.Total)
+	}
+	ordered := make([][]byte, first.Total)
+	found := make([]bool, first.Total)
+	for i, header := range headers {
+		shard := header.Shard
+		if shard == nil {
+			return nil, nil, fmt.Errorf("target %d holds a whole message, not a shard", i+1)
+		}
+		if shard.Set != first.Set || shard.Total != first.Total || shard.Threshold != first.Threshold ||
+			(first.Threshold == 0 && shard.Checksum != first.Checksum) {
+			return nil, nil, fmt.Errorf("target %d belongs to a different set of shards", i+1)
+		}
+		if found[shard.Index] {
+			return nil, nil, fmt.Errorf("shard %d of %d was given more than once", shard.Index+1, shard.Total)
+		}
+		if shard.Threshold > 0 && ShardChecksum(pieces[i]) != shard.Checksum {
+			return nil, nil, fmt.Errorf("share %d of %d doesn't match its checksum, it's corrupted", shard.Index+1, shard.Total)
+		}
+		ordered[shard.Index] = pieces[i]
+		found[shard.Index] = true
+	}
+	if first.Threshold > 0 {
+		return combineShares(ordered, found, first.Threshold)
+	}
+	var missing []int
+	for i := range found {
+		if !found[i] {
+			missing = append(missing, i+1)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("missing shards %v of %d, pass every target of the set", missing, first.Total)
+	}
+	msg := slices.Concat(ordered...)
+	if ShardChecksum(msg) != first.Checksum {
+		return nil, nil, fmt.Errorf("shards don't match the set's checksum, the message is corrupted")
+	}
+	joined := *headers[0]
+	joined.Size = len(msg)
+	joined.Shard = nil
+	return &joined, msg, nil
+}
+
+// combineShares recovers the message and its header from the secret shares that were found
+func combineShares(shares [][]byte, found []bool, threshold int) (*Header, []byte, error) {
+	var xs []byte
+	var given [][]byte
+	for i := range shares {
+		if found[i] && len(given) < threshold {
+			xs = append(xs, byte(i+1))
+			given = append(given, shares[i])
+		}
+	}
+	if len(given) < threshold {
+		return nil, nil, fmt.Errorf("only %d of the %d shares needed were given", len(given), threshold)
+	}
+	for _, share := range given {
+		if len(share) != len(given[0]) {
+			return nil, nil, fmt.Errorf("shares have different lengths, they don't belong together")
+		}
+	}
+	secret := CombineShares(xs, given)
+	header := &Header{}
+	for i := 1; i <= len(secret); i++ {
+		if header.Found(secret[:i]) {
+			if header.Size != len(secret)-i {
+				break
+			}
+			return header, secret[i:], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("shares don't combine into a message, they may be corrupted")
+}
@@ -0,0 +1,32 @@
+package process
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShardHeaderRejectsHugeTotal(t *testing.T) {
+	for _, total := range []int{2, MaxShards, MaxShards + 1, 1 << 40} {
+		b := NewShardHeaderBytes([]byte("piece"), "txt", "", 0, nil, Metadata{}, Shard{Set: "9f86d081884c7d65", Index: 1, Total: total, Checksum: 1})
+		var h Header
+		if !h.Found(b) {
+			t.Fatalf("total %d: header not found", total)
+		}
+		if valid := total <= MaxShards; (h.Shard != nil) != valid {
+			t.Errorf("total %d: parsed shard %+v, want valid=%v", total, h.Shard, valid)
+		}
+	}
+}
+
+func TestJoinShardsRejectsMoreTargetsThanTotal(t *testing.T) {
+	var headers []*Header
+	var pieces [][]byte
+	for i := range 3 {
+		headers = append(headers, &Header{Shard: &Shard{Set: "9f86d081884c7d65", Index: i % 2, Total: 2}})
+		pieces = append(pieces, []byte("piece"))
+	}
+	_, _, err := JoinShards(headers, pieces)
+	if err == nil || !strings.Contains(err.Error(), "only has 2 shards") {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package process
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+	This file contains the helpers for append mode, where the message is written
+	after the logical end of the carrier file instead of into its pixels.
+*/
+
+// TrailerMagic prefixes a raw appended container so extraction can tell it
+// apart from any other trailing data a file may carry.
+const TrailerMagic = "STEGGO!/"
+
+// FinalizeTrailer builds the raw container written after the carrier's logical end
+func FinalizeTrailer(header, msg []byte) []byte {
+	out := make([]byte, 0, len(TrailerMagic)+len(header)+len(msg))
+	out = append(out, TrailerMagic...)
+	out = append(out, header...)
+	return append(out, msg...)
+}
+
+// FinalizeZipTrailer builds a ZIP archive holding the message as a single file, with
+// the header stored in the archive comment. offset is the length of the carrier data
+// the archive will be appended to, so that the central directory offsets are correct
+// for the combined file and it opens with unzip as well as an image viewer.
+func FinalizeZipTrailer(offset int64, name string, header, msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	writer.SetOffset(offset)
+	err := writer.SetComment(TrailerMagic + string(header))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set zip comment: %v", err)
+	}
+	fw, err := writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip entry: %v", err)
+	}
+	_, err = fw.Write(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write zip entry: %v", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close zip writer: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ExtractMsgFromTrailer looks for a container appended after the logical end of the
+// carrier file, either raw or as a ZIP archive.
+func ExtractMsgFromTrailer(data []byte, format string) (*Header, []byte, error) {
+	end, err := LogicalEnd(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	trailing := data[end:]
+	switch {
+	case bytes.HasPrefix(trailing, []byte(TrailerMagic)):
+		return parseTrailer(trailing[len(TrailerMagic):])
+	case bytes.HasPrefix(trailing, []byte("PK\x03\x04")):
+		return extractFromZipTrailer(data)
+	}
+	return nil, nil, fmt.Errorf("no appended message found")
+}
+
+func parseTrailer(b []byte) (*Header, []byte, error) {
+	header := &Header{}
+	idx := bytes.Index(b, []byte("!/"))
+	if idx < 0 || !header.Found(b[:idx+2]) {
+		return nil, nil, fmt.Errorf("appended message header not found")
+	}
+	msg := b[idx+2:]
+	if len(msg) < header.Size {
+		return nil, nil, fmt.Errorf("failed to extract complete message: got %d bytes, expected %d", len(msg), header.Size)
+	}
+	return header, msg[:header.Size], nil
+}
+
+func extractFromZipTrailer(data []byte) (*Header, []byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read appended zip: %v", err)
+	}
+	comment := []byte(reader.Comment)
+	if !bytes.HasPrefix(comment, []byte(TrailerMagic)) || len(reader.File) == 0 {
+		return nil, nil, fmt.Errorf("appended zip does not contain a message")
+	}
+	header := &Header{}
+	if !header.Found(comment[len(TrailerMagic):]) {
+		return nil, nil, fmt.Errorf("appended zip header not found")
+	}
+	rc, err := reader.File[0].Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open appended zip entry: %v", err)
+	}
+	defer rc.Close()
+	msg, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read appended zip entry: %v", err)
+	}
+	if len(msg) != header.Size {
+		return nil, nil, fmt.Errorf("failed to extract complete message: got %d bytes, expected %d", len(msg), header.Size)
+	}
+	return header, msg, nil
+}
+
+// LogicalEnd returns the offset just past the last byte that belongs to the
+// carrier file, e.g. after the PNG IEND chunk, JPEG EOI marker or GIF trailer.
+func LogicalEnd(data []byte, format string) (int, error) {
+	switch format {
+	case "png":
+		return pngEnd(data)
+	case "jpeg":
+		return jpegEnd(data)
+	case "gif":
+		return gifEnd(data)
+	case "bmp":
+		return bmpEnd(data)
+	}
+	return 0, fmt.Errorf("unsupported format for appended data: %v", format)
+}
+
+func pngEnd(data []byte) (int, error) {
+	// 8 byte signature followed by length(4), type(4), data, crc(4) chunks
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		next := pos + 12 + length
+		if next > len(data) {
+			break
+		}
+		if chunkType == "IEND" {
+			return next, nil
+		}
+		pos = next
+	}
+	return 0, fmt.Errorf("PNG IEND chunk not found")
+}
+
+func jpegEnd(data []byte) (int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, fmt.Errorf("JPEG SOI marker not found")
+	}
+	pos := 2
+	for pos+1 < len(data) {
+		if data[pos] != 0xFF {
+			return 0, fmt.Errorf("invalid JPEG marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			pos++
+			continue
+		case marker == 0xD9:
+			return pos + 2, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone markers without a length
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			break
+		}
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if marker != 0xDA {
+			continue
+		}
+		// Skip the entropy coded scan data until the next real marker
+		for pos+1 < len(data) {
+			if data[pos] == 0xFF {
+				next := data[pos+1]
+				if next != 0x00 && !(next >= 0xD0 && next <= 0xD7) && next != 0xFF {
+					break
+				}
+			}
+			pos++
+		}
+	}
+	return 0, fmt.Errorf("JPEG EOI marker not found")
+}
+
+func gifEnd(data []byte) (int, error) {
+	// Header(6) + Logical Screen Descriptor(7)
+	if len(data) < 13 {
+		return 0, fmt.Errorf("GIF header is too short")
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 * (1 << ((data[10] & 0x07) + 1))
+	}
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x3B:
+			return pos + 1, nil
+		case 0x21:
+			// Extension introducer and label, followed by sub-blocks
+			pos = skipGifSubBlocks(data, pos+2)
+		case 0x2C:
+			// Image descriptor(10), optional local color table, LZW code size, sub-blocks
+			if pos+10 > len(data) {
+				return 0, fmt.Errorf("GIF image descriptor is truncated")
+			}
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 * (1 << ((packed & 0x07) + 1))
+			}
+			pos = skipGifSubBlocks(data, pos+1)
+		default:
+			return 0, fmt.Errorf("unexpected GIF block 0x%02x at offset %d", data[pos], pos)
+		}
+	}
+	return 0, fmt.Errorf("GIF trailer not found")
+}
+
+func skipGifSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+func bmpEnd(data []byte) (int, error) {
+	if len(data) < 14 {
+		return 0, fmt.Errorf("BMP header is too short")
+	}
+	size := int(binary.LittleEndian.Uint32(data[2:6]))
+	if size == 0 || size > len(data) {
+		return 0, fmt.Errorf("BMP file size field is invalid: %d", size)
+	}
+	return size, nil
+}
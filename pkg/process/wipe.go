@@ -0,0 +1,117 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/bshore/steggo/pkg/giffile"
+	"github.com/bshore/steggo/pkg/midi"
+	"github.com/bshore/steggo/pkg/y4m"
+	"github.com/bshore/steggo/pkg/ziparchive"
+)
+
+/*
+	This file contains the wiping of embedded messages.
+
+	A message is wiped by embedding random bytes over it the same way it was embedded,
+	so the wiped LSBs look like the rest of the carrier instead of a block of zeros.
+	n is the number of carrier bytes to overwrite, the message's header and message
+	when it was found, or the whole capacity otherwise. Containers stored outside of
+	the carrier's samples, in zip fields, are removed instead.
+*/
+
+// WipeRegion returns the number of carrier bytes taken up by the header and its message
+func WipeRegion(header *Header) int {
+	return header.Length + header.Size
+}
+
+// randomBytes reads n bytes of noise
+func randomBytes(n int, random io.Reader) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(random, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate noise: %v", err)
+	}
+	return b, nil
+}
+
+// WipeImage overwrites the first n bytes of the image's LSBs with noise
+func WipeImage(file image.Image, n int, random io.Reader) (draw.Image, error) {
+	noise, err := randomBytes(min(n, ImageCapacity(file)), random)
+	if err != nil {
+		return nil, err
+	}
+	return EmbedMsgInImage(FinalizeMessage(nil, noise), file)
+}
+
+// WipeImage8 overwrites the first n bytes of the image's 8 bit LSBs with noise
+func WipeImage8(file image.Image, n int, random io.Reader) (*image.NRGBA, error) {
+	noise, err := randomBytes(min(n, ImageCapacity(file)), random)
+	if err != nil {
+		return nil, err
+	}
+	return EmbedMsgInImage8(FinalizeMessage(nil, noise), file)
+}
+
+// WipeGIF overwrites the first n bytes held by the GIF's color tables with noise
+func WipeGIF(file *giffile.GIF, n int, random io.Reader) error {
+	plan, err := PlanGIFCapacity(file)
+	if err != nil {
+		return err
+	}
+	noise, err := randomBytes(min(n, GIFCapacityBytes(plan)), random)
+	if err != nil {
+		return err
+	}
+	return EmbedMsgInGIF(FinalizeMessage(nil, noise), file)
+}
+
+// WipeGIFIndices overwrites the first n bytes held by the GIF's pixel indices with noise
+func WipeGIFIndices(file *giffile.GIF, n int, random io.Reader) error {
+	capacity, err := GIFIndexCapacity(file)
+	if err != nil {
+		return err
+	}
+	noise, err := randomBytes(min(n, capacity), random)
+	if err != nil {
+		return err
+	}
+	return EmbedMsgInGIFIndices(noise, file)
+}
+
+// WipeY4M overwrites the first n bytes of the video's luma, and then chroma, LSBs with noise
+func WipeY4M(video *y4m.Video, n int, random io.Reader) error {
+	var capacity int
+	for _, c := range Y4MFrameCapacity(video, true) {
+		capacity += c
+	}
+	noise, err := randomBytes(min(n, capacity), random)
+	if err != nil {
+		return err
+	}
+	return EmbedMsgInY4M(FinalizeMessage(nil, noise), video, true)
+}
+
+// WipeMIDI overwrites the first n bytes of the note velocities with noise, continuing into
+// the note timing only when the region reaches past the velocities
+func WipeMIDI(file *midi.File, n int, random io.Reader) error {
+	jitter := n > MIDICapacity(file, false)
+	noise, err := randomBytes(min(n, MIDICapacity(file, jitter)), random)
+	if err != nil {
+		return err
+	}
+	return EmbedMsgInMIDI(noise, file, jitter)
+}
+
+// WipeZip removes the container from the archive's extra fields and comment
+func WipeZip(archive *ziparchive.Archive) {
+	for _, f := range archive.Files {
+		f.Extra = ziparchive.RemoveExtraField(f.Extra, ZipExtraID)
+	}
+	if idx := bytes.Index(archive.Comment, []byte(TrailerMagic)); idx >= 0 {
+		archive.Comment = bytes.Clone(archive.Comment[:idx])
+	}
+}
@@ -0,0 +1,113 @@
+package process
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bshore/steggo/pkg/y4m"
+)
+
+/*
+	This file contains the embed/extract functions for Y4M raw video.
+
+	Every byte of the finalized message is spread 2-3-3 across three consecutive
+	samples of a plane, the same way it is spread across the R-G-B values of a pixel.
+	The luma planes of every frame are filled first, in frame order, followed by the
+	chroma planes when they are allowed. Luma-only embedding is therefore a prefix of
+	chroma embedding, and extraction can always walk the same order.
+*/
+
+// Y4MFrameCapacity returns the number of header and message bytes each frame can hold
+func Y4MFrameCapacity(video *y4m.Video, chroma bool) []int {
+	capacities := make([]int, len(video.Frames))
+	for i, frame := range video.Frames {
+		capacities[i] = len(frame.Y) / 3
+		if chroma {
+			capacities[i] += len(frame.U)/3 + len(frame.V)/3
+		}
+	}
+	return capacities
+}
+
+// EmbedMsgInY4M embeds the finalized message data into the luma (and optionally chroma)
+// sample LSBs of the video frames
+func EmbedMsgInY4M(data []byte, video *y4m.Video, chroma bool) error {
+	var capacity int
+	frameCapacities := Y4MFrameCapacity(video, chroma)
+	for _, c := range frameCapacities {
+		capacity += c
+	}
+	if len(data)/3 > capacity {
+		return fmt.Errorf("message won't fit in video: %d bytes to embed, %d bytes available (%s)",
+			len(data)/3, capacity, describeY4MCapacity(frameCapacities))
+	}
+
+	var bitsIndex int
+	for _, plane := range y4mPlanes(video, chroma) {
+		for i := 0; i+2 < len(plane) && bitsIndex < len(data); i += 3 {
+			plane[i] = embedInColor(data[bitsIndex], plane[i])
+			plane[i+1] = embedInColor(data[bitsIndex+1], plane[i+1])
+			plane[i+2] = embedInColor(data[bitsIndex+2], plane[i+2])
+			bitsIndex += 3
+		}
+	}
+	return nil
+}
+
+// describeY4MCapacity lists the number of frames and how many bytes they each hold, as a
+// range when the frames don't all hold the same amount
+func describeY4MCapacity(frameCapacities []int) string {
+	if len(frameCapacities) == 0 {
+		return "no frames"
+	}
+	lo, hi := slices.Min(frameCapacities), slices.Max(frameCapacities)
+	if lo == hi {
+		return fmt.Sprintf("%d frames, %d bytes per frame", len(frameCapacities), lo)
+	}
+	return fmt.Sprintf("%d frames, %d to %d bytes per frame", len(frameCapacities), lo, hi)
+}
+
+// ExtractMsgFromY4M walks the frame planes in embedding order and stops as soon as
+// the header's message size has been read
+func ExtractMsgFromY4M(video *y4m.Video) (*Header, []byte, error) {
+	var headBytes, msgBytes []byte
+	var headerFound bool
+	var header = &Header{}
+
+	for _, plane := range y4mPlanes(video, true) {
+		for i := 0; i+2 < len(plane); i += 3 {
+			extracted := extractFromColor(plane[i], plane[i+1], plane[i+2])
+			if headerFound {
+				if len(msgBytes) >= header.Size {
+					return header, msgBytes, nil
+				}
+				msgBytes = append(msgBytes, extracted)
+			} else {
+				headBytes = append(headBytes, extracted)
+				headerFound = header.Found(headBytes)
+			}
+		}
+	}
+
+	if !headerFound {
+		return nil, nil, fmt.Errorf("failed to extract message, header not found")
+	}
+	if len(msgBytes) < header.Size {
+		return nil, nil, fmt.Errorf("failed to extract complete message: got %d bytes, expected %d", len(msgBytes), header.Size)
+	}
+	return header, msgBytes, nil
+}
+
+// y4mPlanes lists the planes in embedding order: every luma plane, then every chroma plane
+func y4mPlanes(video *y4m.Video, chroma bool) [][]byte {
+	var planes [][]byte
+	for _, frame := range video.Frames {
+		planes = append(planes, frame.Y)
+	}
+	if chroma {
+		for _, frame := range video.Frames {
+			planes = append(planes, frame.U, frame.V)
+		}
+	}
+	return planes
+}
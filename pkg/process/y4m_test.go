@@ -0,0 +1,107 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/bshore/steggo/pkg/y4m"
+)
+
+// testY4M returns a 4:2:0 stream of random frames
+func testY4M(t *testing.T, r *rand.Rand, width, height, frames int) *y4m.Video {
+	t.Helper()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "YUV4MPEG2 W%d H%d F25:1 Ip A1:1 C420jpeg\n", width, height)
+	frameSize := width*height + 2*((width+1)/2)*((height+1)/2)
+	for range frames {
+		b.WriteString("FRAME\n")
+		b.Write(randomBlob(r, frameSize))
+	}
+	video, err := y4m.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+func TestY4MRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(17, 18))
+	for _, chroma := range []bool{false, true} {
+		name := "luma"
+		if chroma {
+			name = "chroma"
+		}
+		video := testY4M(t, r, 32, 18, 3)
+		var chromaBefore [][]byte
+		for _, frame := range video.Frames {
+			chromaBefore = append(chromaBefore, bytes.Clone(frame.U), bytes.Clone(frame.V))
+		}
+		var capacity int
+		for _, c := range Y4MFrameCapacity(video, chroma) {
+			capacity += c
+		}
+		// Fill the capacity, so the message spans every frame and, with chroma, its U and V planes
+		msg := randomBlob(r, capacity)
+		header := NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+		msg = msg[:capacity-len(header)]
+		header = NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+		err := EmbedMsgInY4M(FinalizeMessage(header, msg), video, chroma)
+		if err != nil {
+			t.Fatalf("%s: embed: %v", name, err)
+		}
+		var out bytes.Buffer
+		err = y4m.Encode(&out, video)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", name, err)
+		}
+		embedded, err := y4m.Decode(&out)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		_, extracted, err := ExtractMsgFromY4M(embedded)
+		if err != nil || !bytes.Equal(extracted, msg) {
+			t.Errorf("%s: message didn't round trip: %v", name, err)
+		}
+		var chromaAfter [][]byte
+		for _, frame := range embedded.Frames {
+			chromaAfter = append(chromaAfter, frame.U, frame.V)
+		}
+		if unchanged := bytes.Equal(bytes.Join(chromaBefore, nil), bytes.Join(chromaAfter, nil)); unchanged == chroma {
+			t.Errorf("%s: chroma planes changed=%v", name, !unchanged)
+		}
+	}
+}
+
+func TestY4MRejectsOversizedMessage(t *testing.T) {
+	r := rand.New(rand.NewPCG(19, 20))
+	video := testY4M(t, r, 32, 18, 3)
+	var capacity int
+	for _, c := range Y4MFrameCapacity(video, false) {
+		capacity += c
+	}
+	msg := randomBlob(r, capacity)
+	header := NewHeaderBytes(msg, ".bin", "", 0, nil, Metadata{})
+	err := EmbedMsgInY4M(FinalizeMessage(header, msg), video, false)
+	if err == nil || !strings.Contains(err.Error(), "3 frames, 192 bytes per frame") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDescribeY4MCapacity(t *testing.T) {
+	tests := []struct {
+		capacities []int
+		want       string
+	}{
+		{nil, "no frames"},
+		{[]int{4800, 4800, 4800}, "3 frames, 4800 bytes per frame"},
+		{[]int{4800, 1200, 2400}, "3 frames, 1200 to 4800 bytes per frame"},
+	}
+	for _, test := range tests {
+		if got := describeY4MCapacity(test.capacities); got != test.want {
+			t.Errorf("describeY4MCapacity(%v) = %q, want %q", test.capacities, got, test.want)
+		}
+	}
+}
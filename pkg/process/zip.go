@@ -0,0 +1,84 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bshore/steggo/pkg/ziparchive"
+)
+
+/*
+	This file contains the embed/extract functions for ZIP archives.
+
+	The container is the same one append mode writes (TrailerMagic, header, message), stored
+	either in a private extra field spread across the local file headers, or at the end of the
+	archive comment. Neither location is read when the archive's files are extracted.
+*/
+
+// ZipExtraID is the extra field header ID used to hold the container
+const ZipExtraID uint16 = 0x5347
+
+// ZipExtraCapacity returns the number of container bytes the local file extra fields can hold
+func ZipExtraCapacity(archive *ziparchive.Archive) int {
+	var capacity int
+	for _, f := range archive.Files {
+		room := ziparchive.MaxFieldLen - len(ziparchive.RemoveExtraField(f.Extra, ZipExtraID)) - 4
+		capacity += max(room, 0)
+	}
+	return capacity
+}
+
+// EmbedMsgInZipExtra spreads the container across the local file headers in archive order,
+// filling each header's extra field before moving on to the next
+func EmbedMsgInZipExtra(container []byte, archive *ziparchive.Archive) error {
+	capacity := ZipExtraCapacity(archive)
+	if len(container) > capacity {
+		return fmt.Errorf("message won't fit in archive extra fields: %d bytes to embed, %d bytes available", len(container), capacity)
+	}
+	for _, f := range archive.Files {
+		f.Extra = ziparchive.RemoveExtraField(f.Extra, ZipExtraID)
+		if len(container) == 0 {
+			continue
+		}
+		room := ziparchive.MaxFieldLen - len(f.Extra) - 4
+		if room <= 0 {
+			// The file's own extra fields leave no room for another one
+			continue
+		}
+		chunk := container[:min(len(container), room)]
+		container = container[len(chunk):]
+		f.Extra = ziparchive.AppendExtraField(f.Extra, ZipExtraID, chunk)
+	}
+	return nil
+}
+
+// EmbedMsgInZipComment places the container after any existing archive comment
+func EmbedMsgInZipComment(container []byte, archive *ziparchive.Archive) error {
+	comment := archive.Comment
+	if idx := bytes.Index(comment, []byte(TrailerMagic)); idx >= 0 {
+		comment = comment[:idx]
+	}
+	if len(comment)+len(container) > ziparchive.MaxFieldLen {
+		return fmt.Errorf("message won't fit in archive comment: %d bytes to embed, %d bytes available", len(container), ziparchive.MaxFieldLen-len(comment))
+	}
+	archive.Comment = append(bytes.Clone(comment), container...)
+	return nil
+}
+
+// ExtractMsgFromZip reads the container back from the archive comment, or from the
+// extra fields when the comment doesn't hold one
+func ExtractMsgFromZip(archive *ziparchive.Archive) (*Header, []byte, error) {
+	if idx := bytes.Index(archive.Comment, []byte(TrailerMagic)); idx >= 0 {
+		return parseTrailer(archive.Comment[idx+len(TrailerMagic):])
+	}
+	var container []byte
+	for _, f := range archive.Files {
+		if field, ok := ziparchive.ExtraField(f.Extra, ZipExtraID); ok {
+			container = append(container, field...)
+		}
+	}
+	if !bytes.HasPrefix(container, []byte(TrailerMagic)) {
+		return nil, nil, fmt.Errorf("failed to extract message, header not found")
+	}
+	return parseTrailer(container[len(TrailerMagic):])
+}
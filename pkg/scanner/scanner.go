@@ -0,0 +1,228 @@
+package scanner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bshore/steggo/pkg/encoders"
+	"github.com/bshore/steggo/pkg/extractor"
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/utils"
+)
+
+type Config struct {
+	// Paths are the files and directories to scan, directories are walked recursively
+	Paths []string
+	// Workers is the number of files scanned at once
+	Workers int
+}
+
+// Result is what scanning one file turned up
+type Result struct {
+	Path   string
+	Format string
+	// Header is the header found in the file, nil when there's no steggo data
+	Header *process.Header
+	// Err is set when the file couldn't be read
+	Err error
+	// Skip is why the file wasn't scanned, set for links to anything but a regular file
+	Skip string
+}
+
+// Summary counts the files scanned by what was found in them
+type Summary struct {
+	// Found files hold a steggo header
+	Found int
+	// Clean files are supported carriers without a header
+	Clean int
+	// Skipped files aren't a format steggo embeds into, or are links that weren't followed
+	Skipped int
+	// Failed files couldn't be read
+	Failed int
+}
+
+// Process scans every file under the paths for a steggo header, the same way extract finds
+// one, printing the files that hold one along with its fields. Nothing is ever extracted to
+// disk. Files are scanned in parallel, but reported in the order they were walked.
+func Process(config *Config) Summary {
+	var results []Result
+	for _, path := range config.Paths {
+		results = append(results, walk(path)...)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = scanFile(results[i].Path)
+			}
+		}()
+	}
+	for i := range results {
+		if results[i].Err == nil && results[i].Skip == "" {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var summary Summary
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			summary.Failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", result.Path, result.Err)
+		case result.Skip != "":
+			summary.Skipped++
+			fmt.Fprintf(os.Stderr, "%s: skipped, %s\n", result.Path, result.Skip)
+		case result.Format == "":
+			summary.Skipped++
+		case result.Header == nil:
+			summary.Clean++
+		default:
+			summary.Found++
+			fmt.Fprintf(os.Stdout, "%s: %s\n", result.Path, describe(result))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "scanned %d files: %d with steggo data, %d without, %d not carriers, %d failed\n",
+		len(results), summary.Found, summary.Clean, summary.Skipped, summary.Failed)
+	return summary
+}
+
+// walk lists the regular files under path, recording the ones that can't be read as failed.
+// Links to regular files are scanned like the file itself, while links to directories aren't
+// followed, so a link cycle can't walk forever, and are recorded as skipped along with links
+// to devices and pipes, which opening could block on.
+func walk(path string) []Result {
+	var results []Result
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		// A trailing separator makes WalkDir follow a path that links to a directory
+		path += string(filepath.Separator)
+	}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			results = append(results, Result{Path: p, Err: err})
+			return nil
+		}
+		switch {
+		case d.Type().IsRegular():
+			results = append(results, Result{Path: p})
+		case d.Type()&fs.ModeSymlink != 0:
+			results = append(results, walkLink(p))
+		}
+		return nil
+	})
+	if err != nil {
+		results = append(results, Result{Path: path, Err: err})
+	}
+	return results
+}
+
+// walkLink records the link at p, to be scanned when it leads to a regular file
+func walkLink(p string) Result {
+	info, err := os.Stat(p)
+	switch {
+	case err != nil:
+		return Result{Path: p, Err: err}
+	case info.Mode().IsRegular():
+		return Result{Path: p}
+	case info.IsDir():
+		return Result{Path: p, Skip: "links to a directory, which isn't followed"}
+	}
+	return Result{Path: p, Skip: "links to something other than a regular file"}
+}
+
+// scanFile looks for a steggo header in the file. A file that doesn't decode as a supported
+// carrier is skipped, and one that does but holds no message is clean. Layers can't be told
+// apart from noise without their passphrase, so layered images scan as clean.
+func scanFile(path string) Result {
+	result := Result{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer f.Close()
+	format, err := utils.DetectFormat(f)
+	if err != nil {
+		return result
+	}
+	result.Format = format
+	header, _, err := extractor.Extract(f, "")
+	if err == nil {
+		result.Header = header
+	}
+	return result
+}
+
+// describe lists the header's fields as key=value pairs, quoting values that hold spaces
+func describe(result Result) string {
+	header := result.Header
+	fields := []string{
+		"format=" + result.Format,
+		"size=" + strconv.Itoa(header.Size),
+		"type=" + quote(header.SrcType),
+	}
+	if header.PreEncoding != "" {
+		fields = append(fields, "pre-encoding="+preEncodingNames(header.PreEncoding))
+	}
+	if header.Name != "" {
+		fields = append(fields, "name="+quote(header.Name+header.SrcType))
+	}
+	if header.Mode != 0 {
+		fields = append(fields, fmt.Sprintf("mode=%04o", uint32(header.Mode)))
+	}
+	if shard := header.Shard; shard != nil {
+		fields = append(fields, fmt.Sprintf("shard=%d/%d", shard.Index+1, shard.Total), "set="+shard.Set)
+		if shard.Threshold > 0 {
+			fields = append(fields, "threshold="+strconv.Itoa(shard.Threshold))
+		}
+	}
+	meta := header.Meta
+	if !meta.Created.IsZero() {
+		fields = append(fields, "created="+meta.Created.Format(time.RFC3339))
+	}
+	if !meta.Expires.IsZero() {
+		fields = append(fields, "expires="+meta.Expires.Format(time.RFC3339))
+	}
+	if meta.Sender != "" {
+		fields = append(fields, "sender="+quote(meta.Sender))
+	}
+	if meta.ContentType != "" {
+		fields = append(fields, "content-type="+quote(meta.ContentType))
+	}
+	for _, tag := range meta.Tags {
+		fields = append(fields, "tag="+quote(tag[0]+"="+tag[1]))
+	}
+	return strings.Join(fields, " ")
+}
+
+// preEncodingNames turns the encoder IDs recorded in the header into their names, leaving
+// the IDs as they are when they can't be read
+func preEncodingNames(codes string) string {
+	encs, warnings := encoders.FromHeaderCodes(strings.Split(codes, "/"))
+	if warnings != "" {
+		return quote(codes)
+	}
+	names := make([]string, len(encs))
+	for i, e := range encs {
+		names[i] = e.Name()
+	}
+	return strings.Join(names, "/")
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkLinks(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "files")
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(os.Mkdir(dir, 0755))
+	must(os.WriteFile(filepath.Join(dir, "a.png"), nil, 0644))
+	must(os.Symlink("a.png", filepath.Join(dir, "file-link")))
+	must(os.Symlink(dir, filepath.Join(dir, "cycle")))
+	must(os.Symlink("missing", filepath.Join(dir, "broken")))
+	must(os.Symlink(dir, filepath.Join(root, "dir-link")))
+
+	for _, path := range []string{dir, filepath.Join(root, "dir-link")} {
+		got := map[string]Result{}
+		for _, result := range walk(path) {
+			rel, err := filepath.Rel(path, result.Path)
+			must(err)
+			got[rel] = result
+		}
+		if len(got) != 4 {
+			t.Errorf("%s: walked %d files, want 4: %v", path, len(got), got)
+		}
+		for _, name := range []string{"a.png", "file-link"} {
+			if r, ok := got[name]; !ok || r.Err != nil || r.Skip != "" {
+				t.Errorf("%s: %s should be scanned, got %+v", path, name, r)
+			}
+		}
+		if r := got["cycle"]; r.Skip == "" {
+			t.Errorf("%s: link to a directory should be skipped, got %+v", path, r)
+		}
+		if r := got["broken"]; r.Err == nil {
+			t.Errorf("%s: broken link should fail, got %+v", path, r)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package tarball packs files and directory trees into a tar stream, optionally gzip
+// compressed, and unpacks them again without letting any entry escape the destination.
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bshore/steggo/pkg/encoders"
+)
+
+const (
+	// Ext is the source type recorded for a packed tar stream
+	Ext = ".tar"
+	// GzipExt is the source type recorded for a gzip compressed tar stream
+	GzipExt = ".tar.gz"
+)
+
+// IsTarball reports whether srcType is one of the source types Pack records
+func IsTarball(srcType string) bool {
+	return srcType == Ext || srcType == GzipExt
+}
+
+// Pack writes every path into a tar stream. Directories are walked recursively and stored
+// under their own base name, regular files are stored by base name. Symlinks and other
+// special files are left out.
+func Pack(paths []string, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	var out io.Writer = &buf
+	if compress {
+		gz, _ = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		root := filepath.Base(p)
+		if seen[root] {
+			return nil, fmt.Errorf("more than one input is named %s", root)
+		}
+		seen[root] = true
+		err := filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(p, file)
+			if err != nil {
+				return err
+			}
+			return addFile(tw, file, path.Join(root, filepath.ToSlash(rel)))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack %s: %v", p, err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write tar stream: %v", err)
+	}
+	if gz != nil {
+		err = gz.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress tar stream: %v", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func addFile(tw *tar.Writer, file, name string) error {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// Don't leak the packer's user and group
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	err = tw.WriteHeader(hdr)
+	if err != nil || info.IsDir() {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// List returns the header of every entry in the tar stream
+func List(data []byte) ([]*tar.Header, error) {
+	tr, err := newReader(data)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar stream: %v", err)
+		}
+		entries = append(entries, hdr)
+	}
+}
+
+// Unpack extracts the tar stream into dest and returns the paths it wrote. Only
+// directories and regular files are unpacked, and an entry whose name is absolute or
+// climbs out of dest (including through an existing symlink) fails the whole unpack.
+// Files that already exist are only replaced when overwrite is set.
+func Unpack(data []byte, dest string, overwrite bool) ([]string, error) {
+	tr, err := newReader(data)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination: %v", err)
+	}
+	defer root.Close()
+
+	var written []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to read tar stream: %v", err)
+		}
+		name := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return written, fmt.Errorf("refusing to unpack %q outside of the destination", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = mkdirAll(root, name)
+		case tar.TypeReg:
+			err = mkdirAll(root, filepath.Dir(name))
+			if err == nil {
+				err = writeFile(root, name, tr, hdr.FileInfo().Mode().Perm(), overwrite)
+			}
+		default:
+			return written, fmt.Errorf("refusing to unpack %q: unsupported entry type %q", hdr.Name, hdr.Typeflag)
+		}
+		if errors.Is(err, fs.ErrExist) {
+			return written, fmt.Errorf("%w: %s", fs.ErrExist, filepath.Join(dest, name))
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to unpack %s: %v", hdr.Name, err)
+		}
+		written = append(written, filepath.Join(dest, name))
+	}
+}
+
+// mkdirAll creates dir and any missing parents inside root
+func mkdirAll(root *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	var current string
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		err := root.Mkdir(current, 0755)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes r to name inside root. The mode only applies to a newly created file,
+// an existing one keeps its own.
+func writeFile(root *os.Root, name string, r io.Reader, mode os.FileMode, overwrite bool) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := root.OpenFile(name, flag, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// maxUnpackedSize caps how far a gzip compressed tar stream may expand
+var maxUnpackedSize int64 = encoders.MaxDecompressedSize
+
+func newReader(data []byte) (*tar.Reader, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress tar stream: %v", err)
+		}
+		r = &cappedReader{r: io.LimitReader(gz, maxUnpackedSize+1), max: maxUnpackedSize}
+	}
+	return tar.NewReader(r), nil
+}
+
+// cappedReader fails once more than max bytes have been read, so a gzip bomb surfaces
+// as an error instead of a tar stream that ends early
+type cappedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.max {
+		return 0, fmt.Errorf("tar stream decompresses to more than %d bytes", c.max)
+	}
+	return n, err
+}
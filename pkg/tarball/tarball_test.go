@@ -0,0 +1,35 @@
+package tarball
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGzipStreamIsCapped(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "zeros.bin")
+	err := os.WriteFile(src, make([]byte, 1<<16), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Pack([]string{src}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = List(data)
+	if err != nil {
+		t.Fatalf("list under the cap: %v", err)
+	}
+
+	defer func(max int64) { maxUnpackedSize = max }(maxUnpackedSize)
+	maxUnpackedSize = 1 << 12
+	_, err = List(data)
+	if err == nil || !strings.Contains(err.Error(), "decompresses to more than") {
+		t.Errorf("list over the cap: got %v", err)
+	}
+	_, err = Unpack(data, t.TempDir(), false)
+	if err == nil || !strings.Contains(err.Error(), "decompresses to more than") {
+		t.Errorf("unpack over the cap: got %v", err)
+	}
+}
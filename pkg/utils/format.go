@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/bshore/steggo/pkg/ico"
+	"github.com/bshore/steggo/pkg/midi"
+	"github.com/bshore/steggo/pkg/y4m"
+	"github.com/bshore/steggo/pkg/ziparchive"
+
+	_ "golang.org/x/image/bmp"
+)
+
+// DetectFormat identifies the target file's format from its magic bytes, falling back
+// to the registered image decoders, and rewinds the target afterwards.
+func DetectFormat(target io.ReadSeeker) (string, error) {
+	head := make([]byte, 16)
+	n, _ := io.ReadFull(target, head)
+	head = head[:n]
+	_, _ = target.Seek(0, io.SeekStart)
+
+	if y4m.IsY4M(head) {
+		return "y4m", nil
+	}
+	if ziparchive.IsZip(head) {
+		return "zip", nil
+	}
+	if midi.IsMIDI(head) {
+		return "mid", nil
+	}
+	if ico.IsICO(head) {
+		if head[2] == byte(ico.TypeCUR) {
+			return "cur", nil
+		}
+		return "ico", nil
+	}
+
+	_, format, err := image.DecodeConfig(target)
+	_, _ = target.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode target file: %v", err)
+	}
+	return format, nil
+}
@@ -1,6 +1,13 @@
 package utils
 
-import "os"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
 
 // DestinationExists verifies that a destination exists, if supplied
 func DestinationExists(path string) bool {
@@ -13,3 +20,63 @@ func DestinationExists(path string) bool {
 	}
 	return info.IsDir()
 }
+
+// SafeFilename reduces an embedded file name to a plain file name that can be created
+// inside the destination path, dropping any directories and characters that aren't valid
+// in file names. It returns an empty string when nothing usable is left.
+func SafeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7F || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(strings.TrimSpace(name), ".")
+	if name == "" || name == "." || name == ".." {
+		return ""
+	}
+	if len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 32 {
+			ext = ""
+		}
+		name = name[:255-len(ext)] + ext
+	}
+	return name
+}
+
+// ExitCode is returned by commands that report their result through the exit status
+// instead of an error message
+type ExitCode int
+
+func (e ExitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// Stdio is the path that stands for stdin or stdout on the command line
+const Stdio = "-"
+
+type stdinTarget struct {
+	*bytes.Reader
+}
+
+func (stdinTarget) Close() error { return nil }
+
+// OpenTarget opens the target file, or reads all of stdin when path is -. Formats are
+// detected from magic bytes and several carriers need to rewind, so stdin is buffered
+// into a seekable reader.
+func OpenTarget(path string) (io.ReadSeekCloser, error) {
+	if path == Stdio {
+		contents, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read target from stdin: %v", err)
+		}
+		return stdinTarget{bytes.NewReader(contents)}, nil
+	}
+	target, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open target file %s: %v", path, err)
+	}
+	return target, nil
+}
@@ -0,0 +1,40 @@
+package wiper
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bshore/steggo/pkg/giffile"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessGIF wipes the color tables when the message was found there, or the pixel indices
+// when it was embedded in index mode. Without a message, or with all set, both are wiped.
+func ProcessGIF(all bool, random io.Reader, dest io.Writer, src io.Reader) error {
+	loaded, err := giffile.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding GIF file: %v", err)
+	}
+	paletteHeader, _, paletteErr := process.ExtractMsgFromGIF(loaded)
+	indexHeader, _, indexErr := process.ExtractMsgFromGIFIndices(loaded)
+	switch {
+	case !all && paletteErr == nil:
+		err = process.WipeGIF(loaded, process.WipeRegion(paletteHeader), random)
+	case !all && indexErr == nil:
+		err = process.WipeGIFIndices(loaded, process.WipeRegion(indexHeader), random)
+	default:
+		err = process.WipeGIF(loaded, math.MaxInt, random)
+		if err == nil {
+			err = process.WipeGIFIndices(loaded, math.MaxInt, random)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error wiping GIF: %v", err)
+	}
+	err = giffile.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new GIF image: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package wiper
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bshore/steggo/pkg/ico"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+// ProcessICO wipes every image in the icon, each of which holds its own piece of the message
+func ProcessICO(all bool, random io.Reader, dest io.Writer, src io.Reader) error {
+	loaded, err := ico.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding ICO file: %v", err)
+	}
+	for i := range loaded.Entries {
+		img, err := loaded.Entries[i].Image()
+		if err != nil {
+			return fmt.Errorf("error decoding icon image %d: %v", i, err)
+		}
+		n := math.MaxInt
+		if header, _, err := process.ExtractMsgFromImage(img); err == nil && !all {
+			n = process.WipeRegion(header)
+		}
+		wiped, err := process.WipeImage8(img, n, random)
+		if err != nil {
+			return fmt.Errorf("error wiping icon image %d: %v", i, err)
+		}
+		err = loaded.Entries[i].SetImage(wiped, loaded.Type)
+		if err != nil {
+			return err
+		}
+	}
+	err = ico.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new ICO file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package wiper
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/midi"
+	"github.com/bshore/steggo/pkg/process"
+)
+
+func ProcessMIDI(n int, random io.Reader, dest io.Writer, src io.Reader) error {
+	loaded, err := midi.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding MIDI file: %v", err)
+	}
+	err = process.WipeMIDI(loaded, n, random)
+	if err != nil {
+		return fmt.Errorf("error wiping MIDI file: %v", err)
+	}
+	err = midi.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new MIDI file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package wiper
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+)
+
+func ProcessPNG(n int, random io.Reader, dest io.Writer, src io.Reader) error {
+	loadedImage, err := png.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding PNG file: %v", err)
+	}
+	// Re-encode at the source's bit depth, png.Encode keeps an opaque image without alpha
+	var wiped image.Image
+	if is16Bit(loadedImage) {
+		wiped, err = process.WipeImage(loadedImage, n, random)
+	} else {
+		wiped, err = process.WipeImage8(loadedImage, n, random)
+	}
+	if err != nil {
+		return fmt.Errorf("error wiping image: %v", err)
+	}
+	err = png.Encode(dest, wiped)
+	if err != nil {
+		return fmt.Errorf("error encoding new PNG image: %v", err)
+	}
+	return nil
+}
+
+// is16Bit reports whether the PNG was decoded with 16 bits per channel
+func is16Bit(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
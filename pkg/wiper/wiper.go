@@ -0,0 +1,99 @@
+package wiper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/bshore/steggo/pkg/extractor"
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/utils"
+)
+
+type Config struct {
+	Target io.ReadSeeker
+	// Output is the file the wiped target is written to, - writes it to stdout
+	Output string
+	// All wipes the whole capacity instead of only the region the message was found in
+	All bool
+	// Random is the source of the noise written over the message
+	Random io.Reader
+}
+
+// Process wipes the embedded message from the target, writing it back in its original format.
+// An appended message is cut off at the carrier's logical end, while an embedded one has its
+// LSBs overwritten with noise. The wiped file is checked for a message before it's written.
+func Process(config *Config) error {
+	format, err := utils.DetectFormat(config.Target)
+	if err != nil {
+		return err
+	}
+	contents, err := io.ReadAll(config.Target)
+	if err != nil {
+		return fmt.Errorf("failed to read target file: %v", err)
+	}
+
+	var out bytes.Buffer
+	header, _, extractErr := extractor.Extract(bytes.NewReader(contents), "")
+	if _, _, trailerErr := process.ExtractMsgFromTrailer(contents, format); trailerErr == nil {
+		end, err := process.LogicalEnd(contents, format)
+		if err != nil {
+			return err
+		}
+		out.Write(contents[:end])
+		fmt.Fprintf(os.Stderr, "removed %d bytes of appended data\n", len(contents)-end)
+	} else {
+		n := math.MaxInt
+		if extractErr == nil && !config.All {
+			n = process.WipeRegion(header)
+		}
+		src := bytes.NewReader(contents)
+		switch format {
+		case "png":
+			err = ProcessPNG(n, config.Random, &out, src)
+		case "gif":
+			err = ProcessGIF(config.All, config.Random, &out, src)
+		case "ico", "cur":
+			err = ProcessICO(config.All, config.Random, &out, src)
+		case "y4m":
+			err = ProcessY4M(n, config.Random, &out, src)
+		case "mid":
+			err = ProcessMIDI(n, config.Random, &out, src)
+		case "zip":
+			err = ProcessZip(&out, src)
+		case "jpeg", "bmp":
+			// Embedding writes both out as a png, so only an appended message stays in the format
+			return fmt.Errorf("%s targets only hold appended messages, and none was found", format)
+		default:
+			return fmt.Errorf("unsupported source file format: %v", format)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case format == "zip":
+			fmt.Fprintf(os.Stderr, "removed the embedded message from the archive\n")
+		case extractErr == nil && !config.All:
+			fmt.Fprintf(os.Stderr, "wiped the embedded message\n")
+		default:
+			fmt.Fprintf(os.Stderr, "wiped the whole capacity of the %s file\n", format)
+		}
+	}
+
+	// Make sure nothing can be read back before replacing the target
+	if _, _, err := extractor.Extract(bytes.NewReader(out.Bytes()), ""); err == nil {
+		return fmt.Errorf("a message header is still found after wiping, the target was left unchanged")
+	}
+	fmt.Fprintf(os.Stderr, "no message found after wiping\n")
+	if config.Output == utils.Stdio {
+		_, err = os.Stdout.Write(out.Bytes())
+		return err
+	}
+	err = os.WriteFile(config.Output, out.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing wiped file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package wiper
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/y4m"
+)
+
+func ProcessY4M(n int, random io.Reader, dest io.Writer, src io.Reader) error {
+	loaded, err := y4m.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding Y4M file: %v", err)
+	}
+	err = process.WipeY4M(loaded, n, random)
+	if err != nil {
+		return fmt.Errorf("error wiping video: %v", err)
+	}
+	err = y4m.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new Y4M file: %v", err)
+	}
+	return nil
+}
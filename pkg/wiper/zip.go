@@ -0,0 +1,23 @@
+package wiper
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bshore/steggo/pkg/process"
+	"github.com/bshore/steggo/pkg/ziparchive"
+)
+
+// ProcessZip removes the message from a ZIP based archive's extra fields and comment
+func ProcessZip(dest io.Writer, src io.Reader) error {
+	loaded, err := ziparchive.Decode(src)
+	if err != nil {
+		return fmt.Errorf("error decoding ZIP file: %v", err)
+	}
+	process.WipeZip(loaded)
+	err = ziparchive.Encode(dest, loaded)
+	if err != nil {
+		return fmt.Errorf("error encoding new ZIP file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package y4m reads and writes 8 bit YUV4MPEG2 raw video streams.
+package y4m
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	streamMagic = "YUV4MPEG2"
+	frameMagic  = "FRAME"
+)
+
+// Video is a decoded Y4M stream. Params holds the stream header parameters
+// exactly as they were read so the stream can be written back unchanged.
+type Video struct {
+	Params []string
+	Width  int
+	Height int
+	Chroma string
+	Frames []*Frame
+}
+
+// Frame holds the planes of a single frame, U and V are empty for mono video
+type Frame struct {
+	Params []string
+	Y      []byte
+	U      []byte
+	V      []byte
+}
+
+// IsY4M reports whether b starts with a YUV4MPEG2 stream header
+func IsY4M(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(streamMagic+" "))
+}
+
+// Decode reads every frame of a Y4M stream
+func Decode(r io.Reader) (*Video, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %v", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != streamMagic {
+		return nil, fmt.Errorf("invalid stream header")
+	}
+	video := &Video{Params: fields[1:], Chroma: "420jpeg"}
+	for _, p := range video.Params {
+		switch p[0] {
+		case 'W':
+			video.Width, err = strconv.Atoi(p[1:])
+		case 'H':
+			video.Height, err = strconv.Atoi(p[1:])
+		case 'C':
+			video.Chroma = p[1:]
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream parameter %s: %v", p, err)
+		}
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return nil, fmt.Errorf("invalid frame size %dx%d", video.Width, video.Height)
+	}
+	chromaWidth, chromaHeight, err := video.ChromaSize()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame header: %v", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != frameMagic {
+			return nil, fmt.Errorf("invalid frame header in frame %d", len(video.Frames))
+		}
+		frame := &Frame{
+			Params: fields[1:],
+			Y:      make([]byte, video.Width*video.Height),
+			U:      make([]byte, chromaWidth*chromaHeight),
+			V:      make([]byte, chromaWidth*chromaHeight),
+		}
+		for _, plane := range [][]byte{frame.Y, frame.U, frame.V} {
+			if _, err := io.ReadFull(br, plane); err != nil {
+				return nil, fmt.Errorf("failed to read frame %d: %v", len(video.Frames), err)
+			}
+		}
+		video.Frames = append(video.Frames, frame)
+	}
+	return video, nil
+}
+
+// Encode writes the stream header and every frame
+func Encode(w io.Writer, video *Video) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString(strings.Join(append([]string{streamMagic}, video.Params...), " ") + "\n")
+	if err != nil {
+		return err
+	}
+	for _, frame := range video.Frames {
+		_, err = bw.WriteString(strings.Join(append([]string{frameMagic}, frame.Params...), " ") + "\n")
+		if err != nil {
+			return err
+		}
+		for _, plane := range [][]byte{frame.Y, frame.U, frame.V} {
+			if _, err = bw.Write(plane); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// ChromaSize returns the dimensions of the U and V planes for the stream's chroma subsampling
+func (v *Video) ChromaSize() (int, int, error) {
+	halfWidth := (v.Width + 1) / 2
+	switch v.Chroma {
+	case "420jpeg", "420paldv", "420mpeg2", "420":
+		return halfWidth, (v.Height + 1) / 2, nil
+	case "422":
+		return halfWidth, v.Height, nil
+	case "411":
+		return (v.Width + 3) / 4, v.Height, nil
+	case "444":
+		return v.Width, v.Height, nil
+	case "mono":
+		return 0, 0, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported chroma subsampling: %s", v.Chroma)
+}
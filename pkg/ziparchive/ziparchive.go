@@ -0,0 +1,231 @@
+// Package ziparchive parses and rewrites the raw records of a ZIP archive (including
+// .jar, .docx and other ZIP based formats) so that extra fields and the archive comment
+// can be changed without recompressing or otherwise touching any of the stored files.
+package ziparchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	localSignature   = 0x04034b50
+	centralSignature = 0x02014b50
+	endSignature     = 0x06054b50
+
+	localHeaderLen   = 30
+	centralHeaderLen = 46
+	endHeaderLen     = 22
+
+	// MaxFieldLen is the largest extra field block or comment a ZIP record can hold
+	MaxFieldLen = 0xFFFF
+)
+
+// LocalFile is a local file header along with everything that follows it up to the next
+// record: the file data and any data descriptor, which are kept byte for byte.
+type LocalFile struct {
+	Name  []byte
+	Extra []byte
+
+	header []byte
+	body   []byte
+	offset int
+}
+
+// Archive is a parsed ZIP archive
+type Archive struct {
+	// Prefix holds any data before the first local file header, e.g. a self-extractor stub
+	Prefix  []byte
+	Files   []*LocalFile
+	Comment []byte
+
+	central [][]byte
+	diskEnd []byte
+}
+
+// IsZip reports whether b starts with a ZIP local file header
+func IsZip(b []byte) bool {
+	return len(b) >= 4 && binary.LittleEndian.Uint32(b) == localSignature
+}
+
+// Decode parses the end of central directory record, the central directory and every
+// local file header it references
+func Decode(r io.Reader) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %v", err)
+	}
+	end := findEnd(data)
+	if end < 0 {
+		return nil, fmt.Errorf("end of central directory record not found")
+	}
+	eocd := data[end:]
+	count := int(binary.LittleEndian.Uint16(eocd[10:12]))
+	cdSize := int(binary.LittleEndian.Uint32(eocd[12:16]))
+	cdOffset := int(binary.LittleEndian.Uint32(eocd[16:20]))
+	commentLen := int(binary.LittleEndian.Uint16(eocd[20:22]))
+	if count == 0xFFFF || cdSize == 0xFFFFFFFF || cdOffset == 0xFFFFFFFF {
+		return nil, fmt.Errorf("ZIP64 archives are not supported")
+	}
+	if cdOffset+cdSize > end || end+endHeaderLen+commentLen > len(data) {
+		return nil, fmt.Errorf("central directory is out of bounds")
+	}
+
+	archive := &Archive{
+		Comment: data[end+endHeaderLen : end+endHeaderLen+commentLen],
+		diskEnd: data[end : end+endHeaderLen],
+	}
+
+	pos := cdOffset
+	for i := 0; i < count; i++ {
+		if pos+centralHeaderLen > cdOffset+cdSize || binary.LittleEndian.Uint32(data[pos:]) != centralSignature {
+			return nil, fmt.Errorf("invalid central directory record %d", i)
+		}
+		recLen := centralHeaderLen +
+			int(binary.LittleEndian.Uint16(data[pos+28:])) +
+			int(binary.LittleEndian.Uint16(data[pos+30:])) +
+			int(binary.LittleEndian.Uint16(data[pos+32:]))
+		if pos+recLen > cdOffset+cdSize {
+			return nil, fmt.Errorf("central directory record %d is truncated", i)
+		}
+		archive.central = append(archive.central, data[pos:pos+recLen])
+		pos += recLen
+	}
+
+	// Local files are read in the order they appear in the archive, and each one runs
+	// until the next local file or the start of the central directory.
+	offsets := make([]int, 0, len(archive.central))
+	for _, rec := range archive.central {
+		offsets = append(offsets, int(binary.LittleEndian.Uint32(rec[42:46])))
+	}
+	sort.Ints(offsets)
+	if len(offsets) > 0 && offsets[len(offsets)-1] > cdOffset {
+		return nil, fmt.Errorf("local file header at offset %d is out of bounds", offsets[len(offsets)-1])
+	}
+	if len(offsets) > 0 {
+		archive.Prefix = data[:offsets[0]]
+	} else {
+		archive.Prefix = data[:cdOffset]
+	}
+	for i, offset := range offsets {
+		next := cdOffset
+		if i+1 < len(offsets) {
+			next = offsets[i+1]
+		}
+		if offset+localHeaderLen > next || binary.LittleEndian.Uint32(data[offset:]) != localSignature {
+			return nil, fmt.Errorf("invalid local file header at offset %d", offset)
+		}
+		nameLen := int(binary.LittleEndian.Uint16(data[offset+26:]))
+		extraLen := int(binary.LittleEndian.Uint16(data[offset+28:]))
+		bodyStart := offset + localHeaderLen + nameLen + extraLen
+		if bodyStart > next {
+			return nil, fmt.Errorf("local file header at offset %d is truncated", offset)
+		}
+		archive.Files = append(archive.Files, &LocalFile{
+			Name:   data[offset+localHeaderLen : offset+localHeaderLen+nameLen],
+			Extra:  data[offset+localHeaderLen+nameLen : bodyStart],
+			header: data[offset : offset+localHeaderLen],
+			body:   data[bodyStart:next],
+			offset: offset,
+		})
+	}
+	return archive, nil
+}
+
+// Encode writes the archive, moving every record to its new offset and updating the
+// central directory to match
+func Encode(w io.Writer, archive *Archive) error {
+	if len(archive.Comment) > MaxFieldLen {
+		return fmt.Errorf("archive comment is too long: %d bytes", len(archive.Comment))
+	}
+	var buf bytes.Buffer
+	buf.Write(archive.Prefix)
+
+	newOffsets := make(map[int]int, len(archive.Files))
+	for _, f := range archive.Files {
+		if len(f.Extra) > MaxFieldLen {
+			return fmt.Errorf("extra field of %s is too long: %d bytes", f.Name, len(f.Extra))
+		}
+		newOffsets[f.offset] = buf.Len()
+		header := bytes.Clone(f.header)
+		binary.LittleEndian.PutUint16(header[28:30], uint16(len(f.Extra)))
+		buf.Write(header)
+		buf.Write(f.Name)
+		buf.Write(f.Extra)
+		buf.Write(f.body)
+	}
+
+	cdOffset := buf.Len()
+	for _, rec := range archive.central {
+		rec = bytes.Clone(rec)
+		oldOffset := int(binary.LittleEndian.Uint32(rec[42:46]))
+		binary.LittleEndian.PutUint32(rec[42:46], uint32(newOffsets[oldOffset]))
+		buf.Write(rec)
+	}
+
+	eocd := bytes.Clone(archive.diskEnd)
+	binary.LittleEndian.PutUint32(eocd[12:16], uint32(buf.Len()-cdOffset))
+	binary.LittleEndian.PutUint32(eocd[16:20], uint32(cdOffset))
+	binary.LittleEndian.PutUint16(eocd[20:22], uint16(len(archive.Comment)))
+	buf.Write(eocd)
+	buf.Write(archive.Comment)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ExtraField returns the data of the extra field with the given header ID, if present
+func ExtraField(extra []byte, id uint16) ([]byte, bool) {
+	for pos := 0; pos+4 <= len(extra); {
+		size := int(binary.LittleEndian.Uint16(extra[pos+2:]))
+		if pos+4+size > len(extra) {
+			break
+		}
+		if binary.LittleEndian.Uint16(extra[pos:]) == id {
+			return extra[pos+4 : pos+4+size], true
+		}
+		pos += 4 + size
+	}
+	return nil, false
+}
+
+// RemoveExtraField returns the extra fields without any field using the given header ID
+func RemoveExtraField(extra []byte, id uint16) []byte {
+	var out []byte
+	pos := 0
+	for pos+4 <= len(extra) {
+		size := int(binary.LittleEndian.Uint16(extra[pos+2:]))
+		if pos+4+size > len(extra) {
+			break
+		}
+		if binary.LittleEndian.Uint16(extra[pos:]) != id {
+			out = append(out, extra[pos:pos+4+size]...)
+		}
+		pos += 4 + size
+	}
+	// Keep any padding or malformed trailing bytes untouched
+	return append(out, extra[pos:]...)
+}
+
+// AppendExtraField appends an extra field with the given header ID and data
+func AppendExtraField(extra []byte, id uint16, data []byte) []byte {
+	out := bytes.Clone(extra)
+	out = binary.LittleEndian.AppendUint16(out, id)
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(data)))
+	return append(out, data...)
+}
+
+// findEnd searches backwards for the end of central directory record, which is
+// followed by a comment of up to 64KiB
+func findEnd(data []byte) int {
+	for i := len(data) - endHeaderLen; i >= 0 && i >= len(data)-endHeaderLen-MaxFieldLen; i-- {
+		if binary.LittleEndian.Uint32(data[i:]) == endSignature &&
+			i+endHeaderLen+int(binary.LittleEndian.Uint16(data[i+20:])) <= len(data) {
+			return i
+		}
+	}
+	return -1
+}